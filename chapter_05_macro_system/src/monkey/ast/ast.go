@@ -2,6 +2,8 @@ package ast
 
 import (
 	"bytes"
+	"fmt"
+	"math/big"
 	"monkey/token"
 	"strings"
 )
@@ -43,9 +45,14 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+// Identifier carries the location of its binding once the resolver has run:
+// Depth counts the scopes to walk out and Slot indexes the binding there
 type Identifier struct {
 	Token token.Token
 	Value string
+	Resolved bool
+	Depth int
+	Slot int
 }
 
 func (i *Identifier) String() string { return i.Value }
@@ -53,10 +60,15 @@ func (i *Identifier) String() string { return i.Value }
 func (i *Identifier) ExpressionNode() {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 
+// LetStatement binds either a single Name or, when destructuring,
+// the identifiers found in Pattern. It also represents const declarations.
 type LetStatement struct {
 	Token token.Token
 	Name *Identifier
+	Pattern Expression
+	Type *TypeAnnotation	// optional
 	Value Expression
+	Constant bool
 }
 
 func (ls *LetStatement) StatementNode() {}
@@ -66,7 +78,15 @@ func (ls *LetStatement) String() string{
 	var out bytes.Buffer
 
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String() + " = ")
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
+	if ls.Type != nil {
+		out.WriteString(": " + ls.Type.String())
+	}
+	out.WriteString(" = ")
 
 	if ls.Value != nil {
 		out.WriteString(ls.Value.String())
@@ -99,6 +119,29 @@ func (rs *ReturnStatement) String() string {
 	return out.String()
 }
 
+// InfixDeclaration declares a binary operator implemented by Function,
+// e.g. `infix |> 1 left = fn(a, f) { f(a) }`. Name is the hidden variable
+// the function is bound to.
+type InfixDeclaration struct {
+	Token token.Token	// infix token
+	Operator string
+	Precedence int
+	RightAssociative bool
+	Name *Identifier
+	Function Expression
+}
+
+func (id *InfixDeclaration) StatementNode() {}
+func (id *InfixDeclaration) TokenLiteral() string { return id.Token.Literal }
+
+func (id *InfixDeclaration) String() string {
+	associativity := "left"
+	if id.RightAssociative {
+		associativity = "right"
+	}
+	return fmt.Sprintf("infix %s %d %s = %s;", id.Operator, id.Precedence, associativity, id.Function.String())
+}
+
 type ExpressionStatement struct {
 	Token token.Token
 	Expression Expression
@@ -117,6 +160,7 @@ func (es *ExpressionStatement) String() string {
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big *big.Int	// set instead of Value when the literal does not fit in an int64
 }
 
 func (il *IntegerLiteral) ExpressionNode() {}
@@ -148,6 +192,7 @@ type InfixExpression struct {
 	OperandLeft Expression
 	Operator string
 	OperandRight Expression
+	Function *Identifier	// for operators declared by an infix statement
 }
 
 func (ie *InfixExpression) ExpressionNode() {}
@@ -174,6 +219,14 @@ func (b *Boolean) ExpressionNode() {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
 func (b *Boolean) String() string { return b.Token.Literal }
 
+type NullLiteral struct {
+	Token token.Token
+}
+
+func (nl *NullLiteral) ExpressionNode() {}
+func (nl *NullLiteral) TokenLiteral() string { return nl.Token.Literal }
+func (nl *NullLiteral) String() string { return nl.Token.Literal }
+
 type IfExpression struct {
 	Token token.Token
 	Condition Expression
@@ -199,6 +252,90 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+type ConditionalExpression struct {
+	Token token.Token	// ? token
+	Condition Expression
+	Consequence Expression
+	Alternative Expression
+}
+
+func (ce *ConditionalExpression) ExpressionNode() {}
+func (ce *ConditionalExpression) TokenLiteral() string { return ce.Token.Literal }
+
+func (ce *ConditionalExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ce.Condition.String())
+	out.WriteString(" ? ")
+	out.WriteString(ce.Consequence.String())
+	out.WriteString(" : ")
+	out.WriteString(ce.Alternative.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
+type MatchExpression struct {
+	Token token.Token	// match token
+	Subject Expression
+	Arms []*MatchArm
+}
+
+func (me *MatchExpression) ExpressionNode() {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+	arms := []string{}
+
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString("match (")
+	out.WriteString(me.Subject.String())
+	out.WriteString(") { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// MatchArm is a single `pattern if guard => body` case of a match expression,
+// the guard is optional
+type MatchArm struct {
+	Token token.Token	// first token of the pattern
+	Pattern Expression
+	Guard Expression
+	Body Expression
+}
+
+func (ma *MatchArm) TokenLiteral() string { return ma.Token.Literal }
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(ma.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+
+	return out.String()
+}
+
+type SpreadExpression struct {
+	Token token.Token	// ... token
+	Value Expression
+}
+
+func (se *SpreadExpression) ExpressionNode() {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) String() string { return "..." + se.Value.String() }
+
 type BlockStatement struct {
 	Token token.Token
 	Statements []Statement
@@ -219,8 +356,11 @@ func (bs *BlockStatement) String() string {
 
 type FunctionLiteral struct {
 	Token token.Token
-	Parameters []*Identifier
+	Parameters []Expression	// patterns, DefaultParameter or a trailing rest SpreadExpression
+	ParameterTypes []*TypeAnnotation	// nil when no parameter is annotated, else one entry per parameter
+	ReturnType *TypeAnnotation	// optional
 	Body *BlockStatement
+	Name string	// set when the function is bound by a let statement
 }
 
 func (fl *FunctionLiteral) ExpressionNode() {}
@@ -230,19 +370,55 @@ func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	params := []string{}
 
-	for _, param := range fl.Parameters {
-		params = append(params, param.String())
+	for i, param := range fl.Parameters {
+		if i >= len(fl.ParameterTypes) || fl.ParameterTypes[i] == nil {
+			params = append(params, param.String())
+			continue
+		}
+
+		annotation := ": " + fl.ParameterTypes[i].String()
+		if dp, okay := param.(*DefaultParameter); okay {
+			params = append(params, dp.Pattern.String() + annotation + " = " + dp.Default.String())
+		} else {
+			params = append(params, param.String() + annotation)
+		}
 	}
 
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
+	if fl.ReturnType != nil {
+		out.WriteString("-> " + fl.ReturnType.String() + " ")
+	}
 	out.WriteString(fl.Body.String())
 
 	return out.String()
 }
 
+// TypeAnnotation names the type in `x: int` or `-> int`,
+// the names are only interpreted by the type checker
+type TypeAnnotation struct {
+	Token token.Token
+	Name string
+}
+
+func (ta *TypeAnnotation) TokenLiteral() string { return ta.Token.Literal }
+func (ta *TypeAnnotation) String() string { return ta.Name }
+
+type DefaultParameter struct {
+	Token token.Token	// = token
+	Pattern Expression
+	Default Expression
+}
+
+func (dp *DefaultParameter) ExpressionNode() {}
+func (dp *DefaultParameter) TokenLiteral() string { return dp.Token.Literal }
+
+func (dp *DefaultParameter) String() string {
+	return dp.Pattern.String() + " = " + dp.Default.String()
+}
+
 type CallExpression struct {
 	Token token.Token
 	Function Expression
@@ -304,6 +480,7 @@ type IndexExpression struct {
 	Token token.Token
 	Array Expression
 	Index Expression
+	Optional bool	// h?[key], null when h is null, skipping the rest of the chain
 }
 
 func (ie *IndexExpression) ExpressionNode() {}
@@ -314,6 +491,9 @@ func (ie *IndexExpression) String() string {
 
 	out.WriteString("(")
 	out.WriteString(ie.Array.String())
+	if ie.Optional {
+		out.WriteString("?")
+	}
 	out.WriteString("[")
 	out.WriteString(ie.Index.String())
 	out.WriteString("]")
@@ -325,6 +505,7 @@ func (ie *IndexExpression) String() string {
 type HashLiteral struct {
 	Token token.Token
 	Pairs map[Expression] Expression
+	Keys []Expression	// keys in source order
 }
 
 func (hl *HashLiteral) ExpressionNode() {}
@@ -335,8 +516,8 @@ func (hl *HashLiteral) String() string {
 
 	pairs := []string{}
 
-	for key, val := range hl.Pairs {
-		pairs = append(pairs, key.String() + ": " + val.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String() + ": " + hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
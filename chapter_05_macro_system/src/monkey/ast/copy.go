@@ -0,0 +1,280 @@
+package ast
+
+// Children returns the direct child nodes of node in source order,
+// type annotations excluded
+func Children(node Node) []Node {
+	children := []Node{}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, stmt := range node.Statements {
+			children = append(children, stmt)
+		}
+
+	case *LetStatement:
+		if node.Pattern != nil {
+			children = append(children, node.Pattern)
+		} else {
+			children = append(children, node.Name)
+		}
+		children = append(children, node.Value)
+
+	case *ReturnStatement:
+		children = append(children, node.Value)
+
+	case *InfixDeclaration:
+		children = append(children, node.Name, node.Function)
+
+	case *ExpressionStatement:
+		children = append(children, node.Expression)
+
+	case *PrefixExpression:
+		children = append(children, node.Operand)
+
+	case *InfixExpression:
+		children = append(children, node.OperandLeft, node.OperandRight)
+		if node.Function != nil {
+			children = append(children, node.Function)
+		}
+
+	case *IfExpression:
+		children = append(children, node.Condition, node.Consequence)
+		if node.Alternative != nil {
+			children = append(children, node.Alternative)
+		}
+
+	case *ConditionalExpression:
+		children = append(children, node.Condition, node.Consequence, node.Alternative)
+
+	case *MatchExpression:
+		children = append(children, node.Subject)
+		for _, arm := range node.Arms {
+			children = append(children, arm)
+		}
+
+	case *MatchArm:
+		children = append(children, node.Pattern)
+		if node.Guard != nil {
+			children = append(children, node.Guard)
+		}
+		children = append(children, node.Body)
+
+	case *SpreadExpression:
+		children = append(children, node.Value)
+
+	case *BlockStatement:
+		for _, stmt := range node.Statements {
+			children = append(children, stmt)
+		}
+
+	case *FunctionLiteral:
+		for _, param := range node.Parameters {
+			children = append(children, param)
+		}
+		children = append(children, node.Body)
+
+	case *DefaultParameter:
+		children = append(children, node.Pattern, node.Default)
+
+	case *CallExpression:
+		children = append(children, node.Function)
+		for _, arg := range node.Arguments {
+			children = append(children, arg)
+		}
+
+	case *ArrayLiteral:
+		for _, element := range node.Elements {
+			children = append(children, element)
+		}
+
+	case *IndexExpression:
+		children = append(children, node.Array, node.Index)
+
+	case *HashLiteral:
+		for _, key := range node.Keys {
+			children = append(children, key, node.Pairs[key])
+		}
+
+	case *MacroLiteral:
+		for _, param := range node.Parameters {
+			children = append(children, param)
+		}
+		children = append(children, node.Body)
+	}
+
+	return children
+}
+
+// Copy returns a deep copy of node, so that it can be modified without
+// affecting the original. Type annotations are shared.
+func Copy(node Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		return &Program{Statements: CopyStatements(node.Statements)}
+
+	case *Identifier:
+		identifier := *node
+		return &identifier
+
+	case *LetStatement:
+		let := *node
+		if node.Name != nil {
+			let.Name = Copy(node.Name).(*Identifier)
+		}
+		let.Pattern = CopyExpression(node.Pattern)
+		let.Value = CopyExpression(node.Value)
+		return &let
+
+	case *ReturnStatement:
+		return &ReturnStatement{Token: node.Token, Value: CopyExpression(node.Value)}
+
+	case *InfixDeclaration:
+		declaration := *node
+		declaration.Name = Copy(node.Name).(*Identifier)
+		declaration.Function = CopyExpression(node.Function)
+		return &declaration
+
+	case *ExpressionStatement:
+		return &ExpressionStatement{Token: node.Token, Expression: CopyExpression(node.Expression)}
+
+	case *IntegerLiteral:
+		literal := *node
+		return &literal
+
+	case *PrefixExpression:
+		return &PrefixExpression{Token: node.Token, Operator: node.Operator, Operand: CopyExpression(node.Operand)}
+
+	case *InfixExpression:
+		ie := &InfixExpression{
+			Token: node.Token,
+			OperandLeft: CopyExpression(node.OperandLeft),
+			Operator: node.Operator,
+			OperandRight: CopyExpression(node.OperandRight),
+		}
+		if node.Function != nil {
+			ie.Function = Copy(node.Function).(*Identifier)
+		}
+		return ie
+
+	case *Boolean:
+		return &Boolean{Token: node.Token, Value: node.Value}
+
+	case *NullLiteral:
+		return &NullLiteral{Token: node.Token}
+
+	case *IfExpression:
+		ie := &IfExpression{Token: node.Token, Condition: CopyExpression(node.Condition)}
+		ie.Consequence = CopyBlock(node.Consequence)
+		ie.Alternative = CopyBlock(node.Alternative)
+		return ie
+
+	case *ConditionalExpression:
+		return &ConditionalExpression{
+			Token: node.Token,
+			Condition: CopyExpression(node.Condition),
+			Consequence: CopyExpression(node.Consequence),
+			Alternative: CopyExpression(node.Alternative),
+		}
+
+	case *MatchExpression:
+		me := &MatchExpression{Token: node.Token, Subject: CopyExpression(node.Subject)}
+		for _, arm := range node.Arms {
+			me.Arms = append(me.Arms, Copy(arm).(*MatchArm))
+		}
+		return me
+
+	case *MatchArm:
+		return &MatchArm{
+			Token: node.Token,
+			Pattern: CopyExpression(node.Pattern),
+			Guard: CopyExpression(node.Guard),
+			Body: CopyExpression(node.Body),
+		}
+
+	case *SpreadExpression:
+		return &SpreadExpression{Token: node.Token, Value: CopyExpression(node.Value)}
+
+	case *BlockStatement:
+		return &BlockStatement{Token: node.Token, Statements: CopyStatements(node.Statements)}
+
+	case *FunctionLiteral:
+		fl := *node
+		fl.Parameters = CopyExpressions(node.Parameters)
+		fl.Body = CopyBlock(node.Body)
+		return &fl
+
+	case *DefaultParameter:
+		return &DefaultParameter{Token: node.Token, Pattern: CopyExpression(node.Pattern), Default: CopyExpression(node.Default)}
+
+	case *CallExpression:
+		return &CallExpression{Token: node.Token, Function: CopyExpression(node.Function), Arguments: CopyExpressions(node.Arguments)}
+
+	case *StringLiteral:
+		return &StringLiteral{Token: node.Token, Value: node.Value}
+
+	case *ArrayLiteral:
+		return &ArrayLiteral{Token: node.Token, Elements: CopyExpressions(node.Elements)}
+
+	case *IndexExpression:
+		ie := *node
+		ie.Array = CopyExpression(node.Array)
+		ie.Index = CopyExpression(node.Index)
+		return &ie
+
+	case *HashLiteral:
+		hl := &HashLiteral{Token: node.Token, Pairs: make(map[Expression]Expression), Keys: []Expression{}}
+		for _, key := range node.Keys {
+			NewKey := CopyExpression(key)
+			hl.Pairs[NewKey] = CopyExpression(node.Pairs[key])
+			hl.Keys = append(hl.Keys, NewKey)
+		}
+		return hl
+
+	case *MacroLiteral:
+		ml := &MacroLiteral{Token: node.Token, Body: CopyBlock(node.Body)}
+		for _, param := range node.Parameters {
+			ml.Parameters = append(ml.Parameters, Copy(param).(*Identifier))
+		}
+		return ml
+	}
+
+	return node
+}
+
+func CopyExpression(expression Expression) Expression {
+	if expression == nil {
+		return nil
+	}
+	copied, _ := Copy(expression).(Expression)
+	return copied
+}
+
+func CopyExpressions(expressions []Expression) []Expression {
+	if expressions == nil {
+		return nil
+	}
+	copied := []Expression{}
+	for _, expression := range expressions {
+		copied = append(copied, CopyExpression(expression))
+	}
+	return copied
+}
+
+func CopyStatements(statements []Statement) []Statement {
+	if statements == nil {
+		return nil
+	}
+	copied := []Statement{}
+	for _, stmt := range statements {
+		c, _ := Copy(stmt).(Statement)
+		copied = append(copied, c)
+	}
+	return copied
+}
+
+func CopyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return Copy(block).(*BlockStatement)
+}
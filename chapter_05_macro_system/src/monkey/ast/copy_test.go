@@ -0,0 +1,61 @@
+package ast
+
+import (
+	"testing"
+)
+
+func TestCopy(t *testing.T) {
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+
+	original := &Program{
+		Statements: []Statement{
+			&LetStatement{Name: ident("f"), Value: &FunctionLiteral{
+				Parameters: []Expression{ident("x"), &DefaultParameter{Pattern: ident("y"), Default: &IntegerLiteral{Value: 1}}},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &CallExpression{Function: ident("g"), Arguments: []Expression{ident("x")}}},
+				}},
+			}},
+			&ExpressionStatement{Expression: &IfExpression{
+				Condition: &Boolean{Value: true},
+				Consequence: &BlockStatement{Statements: []Statement{&ReturnStatement{Value: ident("y")}}},
+			}},
+			&ExpressionStatement{Expression: &HashLiteral{
+				Pairs: map[Expression]Expression{ident("k"): &ArrayLiteral{Elements: []Expression{ident("v")}}},
+			}},
+		},
+	}
+	hash := original.Statements[2].(*ExpressionStatement).Expression.(*HashLiteral)
+	for key := range hash.Pairs {
+		hash.Keys = append(hash.Keys, key)
+	}
+
+	copied := Copy(original)
+
+	if copied.String() != original.String() {
+		t.Fatalf("copy differs, got=%q, want=%q", copied.String(), original.String())
+	}
+
+	count := 0
+	var rename func(node Node)
+	rename = func(node Node) {
+		if identifier, okay := node.(*Identifier); okay {
+			identifier.Value += "_copy"
+			count += 1
+		}
+		for _, child := range Children(node) {
+			rename(child)
+		}
+	}
+	rename(copied)
+
+	if count != 8 {
+		t.Errorf("Children visited %d identifiers, want=8", count)
+	}
+
+	if original.Statements[0].(*LetStatement).Name.Value != "f" {
+		t.Errorf("modifying the copy changed the original")
+	}
+	if copied.String() == original.String() {
+		t.Errorf("copy shares identifiers with the original")
+	}
+}
@@ -0,0 +1,298 @@
+package ast
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// Format prints node as indented source code that parses back into the
+// same tree. Unlike String it keeps the braces of blocks and the full
+// function of calls, and only parenthesizes operators nested in others.
+func Format(node Node) string {
+	f := &Formatter{}
+	f.Node(node)
+	return f.out.String()
+}
+
+type Formatter struct {
+	out    bytes.Buffer
+	indent int
+}
+
+func (f *Formatter) Write(strs ...string) {
+	for _, str := range strs {
+		f.out.WriteString(str)
+	}
+}
+
+func (f *Formatter) Newline() {
+	f.out.WriteString("\n" + strings.Repeat("    ", f.indent))
+}
+
+func (f *Formatter) Node(node Node) {
+	switch node := node.(type) {
+	case *Program:
+		for i, stmt := range node.Statements {
+			if i > 0 {
+				f.Newline()
+			}
+			f.Statement(stmt)
+		}
+	case Statement:
+		f.Statement(node)
+	case Expression:
+		f.Expression(node, false)
+	case *MatchArm:
+		f.Arm(node)
+	case *TypeAnnotation:
+		f.Write(node.Name)
+	}
+}
+
+func (f *Formatter) Statement(stmt Statement) {
+	switch stmt := stmt.(type) {
+	case *LetStatement:
+		if stmt.Constant {
+			f.Write("const ")
+		} else {
+			f.Write("let ")
+		}
+		if stmt.Pattern != nil {
+			f.Expression(stmt.Pattern, false)
+		} else {
+			f.Write(stmt.Name.Value)
+		}
+		if stmt.Type != nil {
+			f.Write(": ", stmt.Type.Name)
+		}
+		f.Write(" = ")
+		f.Expression(stmt.Value, false)
+
+	case *InfixDeclaration:
+		f.Write("infix ", stmt.Operator, " ", strconv.Itoa(stmt.Precedence))
+		if stmt.RightAssociative {
+			f.Write(" right")
+		}
+		f.Write(" = ")
+		f.Expression(stmt.Function, false)
+
+	case *ReturnStatement:
+		f.Write("return")
+		if stmt.Value != nil {
+			f.Write(" ")
+			f.Expression(stmt.Value, false)
+		}
+
+	case *ExpressionStatement:
+		f.Expression(stmt.Expression, false)
+	}
+
+	f.Write(";")
+}
+
+// Expression prints expression, operand tells whether it is part of an
+// operator expression and needs parentheses if it is one itself
+func (f *Formatter) Expression(expression Expression, operand bool) {
+	switch node := expression.(type) {
+	case *Identifier:
+		f.Write(node.Value)
+
+	case *IntegerLiteral:
+		switch {
+		case node.Token.Literal != "":
+			f.Write(node.Token.Literal)
+		case node.Big != nil:
+			f.Write(node.Big.String())
+		default:
+			f.Write(strconv.FormatInt(node.Value, 10))
+		}
+
+	case *Boolean:
+		f.Write(strconv.FormatBool(node.Value))
+
+	case *NullLiteral:
+		f.Write("null")
+
+	case *StringLiteral:
+		f.Write("\"", node.Value, "\"")
+
+	case *PrefixExpression:
+		f.Open(operand)
+		f.Write(node.Operator)
+		f.Expression(node.Operand, true)
+		f.Close(operand)
+
+	case *InfixExpression:
+		f.Open(operand)
+		f.Expression(node.OperandLeft, true)
+		f.Write(" ", node.Operator, " ")
+		f.Expression(node.OperandRight, true)
+		f.Close(operand)
+
+	case *ConditionalExpression:
+		f.Open(operand)
+		f.Expression(node.Condition, true)
+		f.Write(" ? ")
+		f.Expression(node.Consequence, true)
+		f.Write(" : ")
+		f.Expression(node.Alternative, true)
+		f.Close(operand)
+
+	case *IfExpression:
+		f.Write("if (")
+		f.Expression(node.Condition, false)
+		f.Write(") ")
+		f.Block(node.Consequence)
+		if node.Alternative != nil {
+			f.Write(" else ")
+			f.Block(node.Alternative)
+		}
+
+	case *MatchExpression:
+		f.Write("match (")
+		f.Expression(node.Subject, false)
+		f.Write(") {")
+		f.indent += 1
+		for i, arm := range node.Arms {
+			f.Newline()
+			f.Arm(arm)
+			if i < len(node.Arms) - 1 {
+				f.Write(",")
+			}
+		}
+		f.indent -= 1
+		f.Newline()
+		f.Write("}")
+
+	case *SpreadExpression:
+		f.Write("...")
+		f.Expression(node.Value, true)
+
+	case *BlockStatement:
+		f.Block(node)
+
+	case *FunctionLiteral:
+		f.Write("fn(")
+		for i, param := range node.Parameters {
+			if i > 0 {
+				f.Write(", ")
+			}
+			if i < len(node.ParameterTypes) && node.ParameterTypes[i] != nil {
+				pattern, def := param, Expression(nil)
+				if dp, okay := param.(*DefaultParameter); okay {
+					pattern, def = dp.Pattern, dp.Default
+				}
+				f.Expression(pattern, false)
+				f.Write(": ", node.ParameterTypes[i].Name)
+				if def != nil {
+					f.Write(" = ")
+					f.Expression(def, false)
+				}
+				continue
+			}
+			f.Expression(param, false)
+		}
+		f.Write(") ")
+		if node.ReturnType != nil {
+			f.Write("-> ", node.ReturnType.Name, " ")
+		}
+		f.Block(node.Body)
+
+	case *DefaultParameter:
+		f.Expression(node.Pattern, false)
+		f.Write(" = ")
+		f.Expression(node.Default, false)
+
+	case *MacroLiteral:
+		f.Write("macro(")
+		for i, param := range node.Parameters {
+			if i > 0 {
+				f.Write(", ")
+			}
+			f.Write(param.Value)
+		}
+		f.Write(") ")
+		f.Block(node.Body)
+
+	case *CallExpression:
+		f.Expression(node.Function, true)
+		f.Write("(")
+		f.Expressions(node.Arguments)
+		f.Write(")")
+
+	case *ArrayLiteral:
+		f.Write("[")
+		f.Expressions(node.Elements)
+		f.Write("]")
+
+	case *IndexExpression:
+		f.Expression(node.Array, true)
+		if node.Optional {
+			f.Write("?")
+		}
+		f.Write("[")
+		f.Expression(node.Index, false)
+		f.Write("]")
+
+	case *HashLiteral:
+		f.Write("{")
+		for i, key := range node.Keys {
+			if i > 0 {
+				f.Write(", ")
+			}
+			f.Expression(key, false)
+			f.Write(": ")
+			f.Expression(node.Pairs[key], false)
+		}
+		f.Write("}")
+	}
+}
+
+func (f *Formatter) Expressions(expressions []Expression) {
+	for i, expression := range expressions {
+		if i > 0 {
+			f.Write(", ")
+		}
+		f.Expression(expression, false)
+	}
+}
+
+func (f *Formatter) Block(block *BlockStatement) {
+	if len(block.Statements) == 0 {
+		f.Write("{}")
+		return
+	}
+
+	f.Write("{")
+	f.indent += 1
+	for _, stmt := range block.Statements {
+		f.Newline()
+		f.Statement(stmt)
+	}
+	f.indent -= 1
+	f.Newline()
+	f.Write("}")
+}
+
+func (f *Formatter) Arm(arm *MatchArm) {
+	f.Expression(arm.Pattern, false)
+	if arm.Guard != nil {
+		f.Write(" if ")
+		f.Expression(arm.Guard, false)
+	}
+	f.Write(" => ")
+	f.Expression(arm.Body, false)
+}
+
+func (f *Formatter) Open(operand bool) {
+	if operand {
+		f.Write("(")
+	}
+}
+
+func (f *Formatter) Close(operand bool) {
+	if operand {
+		f.Write(")")
+	}
+}
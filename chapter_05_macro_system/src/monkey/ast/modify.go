@@ -1,69 +1,289 @@
 package ast
 
+import (
+	"fmt"
+)
+
 type ModifierFunc func(Node) Node
 
-func Modify(node Node, modifier ModifierFunc) Node {
+// Modify replaces each node of the tree, children first, by what modifier
+// returns for it. It fails when a replacement does not fit where the node
+// was, e.g. a statement in place of an expression, instead of leaving a nil
+// in the tree. Type annotations are not visited.
+func Modify(node Node, modifier ModifierFunc) (Node, error) {
+	var err error
 
 	switch node := node.(type) {
 
 	case *Program:
 		for i, statement := range node.Statements {
-			node.Statements[i], _ = Modify(statement, modifier).(Statement)
+			if node.Statements[i], err = ModifyStatement(statement, modifier); err != nil {
+				return nil, err
+			}
 		}
 
 	case *ExpressionStatement:
-		node.Expression, _ = Modify(node.Expression, modifier).(Expression)
+		if node.Expression, err = ModifyExpression(node.Expression, modifier); err != nil {
+			return nil, err
+		}
 
 	case *InfixExpression:
-		node.OperandLeft, _ = Modify(node.OperandLeft, modifier).(Expression)
-		node.OperandRight, _ = Modify(node.OperandRight, modifier).(Expression)
+		if node.OperandLeft, err = ModifyExpression(node.OperandLeft, modifier); err != nil {
+			return nil, err
+		}
+		if node.OperandRight, err = ModifyExpression(node.OperandRight, modifier); err != nil {
+			return nil, err
+		}
+		if node.Function != nil {
+			if node.Function, err = ModifyIdentifier(node.Function, modifier); err != nil {
+				return nil, err
+			}
+		}
 
 	case *PrefixExpression:
-		node.Operand, _ = Modify(node.Operand, modifier).(Expression)
+		if node.Operand, err = ModifyExpression(node.Operand, modifier); err != nil {
+			return nil, err
+		}
 
 	case *IndexExpression:
-		node.Array, _ = Modify(node.Array, modifier).(Expression)
-		node.Index, _ = Modify(node.Index, modifier).(Expression)
+		if node.Array, err = ModifyExpression(node.Array, modifier); err != nil {
+			return nil, err
+		}
+		if node.Index, err = ModifyExpression(node.Index, modifier); err != nil {
+			return nil, err
+		}
 
 	case *IfExpression:
-		node.Condition, _ = Modify(node.Condition, modifier).(Expression)
-		node.Consequence, _ = Modify(node.Consequence, modifier).(*BlockStatement)
-		if node.Alternative != nil {
-			node.Alternative, _ = Modify(node.Alternative, modifier).(*BlockStatement)
+		if node.Condition, err = ModifyExpression(node.Condition, modifier); err != nil {
+			return nil, err
+		}
+		if node.Consequence, err = ModifyBlock(node.Consequence, modifier); err != nil {
+			return nil, err
+		}
+		if node.Alternative, err = ModifyBlock(node.Alternative, modifier); err != nil {
+			return nil, err
+		}
+
+	case *ConditionalExpression:
+		if node.Condition, err = ModifyExpression(node.Condition, modifier); err != nil {
+			return nil, err
+		}
+		if node.Consequence, err = ModifyExpression(node.Consequence, modifier); err != nil {
+			return nil, err
+		}
+		if node.Alternative, err = ModifyExpression(node.Alternative, modifier); err != nil {
+			return nil, err
+		}
+
+	case *MatchExpression:
+		if node.Subject, err = ModifyExpression(node.Subject, modifier); err != nil {
+			return nil, err
+		}
+		for i, arm := range node.Arms {
+			modified, err := Modify(arm, modifier)
+			if err != nil {
+				return nil, err
+			}
+			replacement, okay := modified.(*MatchArm)
+			if !okay {
+				return nil, Mismatch(arm, modified, "a match arm")
+			}
+			node.Arms[i] = replacement
+		}
+
+	case *MatchArm:
+		if node.Pattern, err = ModifyExpression(node.Pattern, modifier); err != nil {
+			return nil, err
+		}
+		if node.Guard, err = ModifyExpression(node.Guard, modifier); err != nil {
+			return nil, err
+		}
+		if node.Body, err = ModifyExpression(node.Body, modifier); err != nil {
+			return nil, err
+		}
+
+	case *DefaultParameter:
+		if node.Pattern, err = ModifyExpression(node.Pattern, modifier); err != nil {
+			return nil, err
+		}
+		if node.Default, err = ModifyExpression(node.Default, modifier); err != nil {
+			return nil, err
+		}
+
+	case *SpreadExpression:
+		if node.Value, err = ModifyExpression(node.Value, modifier); err != nil {
+			return nil, err
 		}
 
 	case *BlockStatement:
-		for i, _ := range node.Statements {
-			node.Statements[i], _ = Modify(node.Statements[i], modifier).(Statement)
+		for i, statement := range node.Statements {
+			if node.Statements[i], err = ModifyStatement(statement, modifier); err != nil {
+				return nil, err
+			}
 		}
 
 	case *ReturnStatement:
-		node.Value, _ = Modify(node.Value, modifier).(Expression)
+		if node.Value, err = ModifyExpression(node.Value, modifier); err != nil {
+			return nil, err
+		}
+
+	case *InfixDeclaration:
+		if node.Name, err = ModifyIdentifier(node.Name, modifier); err != nil {
+			return nil, err
+		}
+		if node.Function, err = ModifyExpression(node.Function, modifier); err != nil {
+			return nil, err
+		}
 
 	case *LetStatement:
-		node.Value, _ = Modify(node.Value, modifier).(Expression)
+		if node.Name != nil {
+			if node.Name, err = ModifyIdentifier(node.Name, modifier); err != nil {
+				return nil, err
+			}
+		}
+		if node.Pattern, err = ModifyExpression(node.Pattern, modifier); err != nil {
+			return nil, err
+		}
+		if node.Value, err = ModifyExpression(node.Value, modifier); err != nil {
+			return nil, err
+		}
 
 	case *FunctionLiteral:
-		for i, _ := range node.Parameters {
-			node.Parameters[i], _ = Modify(node.Parameters[i], modifier).(*Identifier)
+		if err = ModifyExpressions(node.Parameters, modifier); err != nil {
+			return nil, err
+		}
+		if node.Body, err = ModifyBlock(node.Body, modifier); err != nil {
+			return nil, err
+		}
+
+	case *CallExpression:
+		if node.Function, err = ModifyExpression(node.Function, modifier); err != nil {
+			return nil, err
+		}
+		if err = ModifyExpressions(node.Arguments, modifier); err != nil {
+			return nil, err
 		}
-		node.Body, _ = Modify(node.Body, modifier).(*BlockStatement)
 
 	case *ArrayLiteral:
-		for i, _ := range node.Elements {
-			node.Elements[i], _ = Modify(node.Elements[i], modifier).(Expression)
+		if err = ModifyExpressions(node.Elements, modifier); err != nil {
+			return nil, err
 		}
 
-    case *HashLiteral:
-        pairs := make(map[Expression]Expression)
-        for OldKey, OldVal := range node.Pairs {
-            NewKey, _ := Modify(OldKey, modifier).(Expression)
-            NewVal, _ := Modify(OldVal, modifier).(Expression)
-            pairs[NewKey] = NewVal
-        }
-        node.Pairs = pairs
+	case *HashLiteral:
+		pairs := make(map[Expression]Expression)
+		keys := []Expression{}
+		for _, OldKey := range node.Keys {
+			NewKey, err := ModifyExpression(OldKey, modifier)
+			if err != nil {
+				return nil, err
+			}
+			NewVal, err := ModifyExpression(node.Pairs[OldKey], modifier)
+			if err != nil {
+				return nil, err
+			}
+			pairs[NewKey] = NewVal
+			keys = append(keys, NewKey)
+		}
+		node.Pairs = pairs
+		node.Keys = keys
+
+	case *MacroLiteral:
+		for i, param := range node.Parameters {
+			if node.Parameters[i], err = ModifyIdentifier(param, modifier); err != nil {
+				return nil, err
+			}
+		}
+		if node.Body, err = ModifyBlock(node.Body, modifier); err != nil {
+			return nil, err
+		}
+	}
+
+	modified := modifier(node)
+	if modified == nil {
+		return nil, fmt.Errorf("cannot replace %s with nil", node.String())
+	}
+
+	return modified, nil
+}
+
+// Mismatch reports that original cannot be replaced with modified,
+// which is not of the wanted kind
+func Mismatch(original Node, modified Node, want string) error {
+	return fmt.Errorf("cannot replace %s with %s: want %s, got %T", original.String(), modified.String(), want, modified)
+}
+
+// ModifyExpression modifies expression, which may be nil for optional parts
+func ModifyExpression(expression Expression, modifier ModifierFunc) (Expression, error) {
+	if expression == nil {
+		return nil, nil
+	}
+
+	modified, err := Modify(expression, modifier)
+	if err != nil {
+		return nil, err
+	}
+
+	replacement, okay := modified.(Expression)
+	if !okay {
+		return nil, Mismatch(expression, modified, "an expression")
+	}
+
+	return replacement, nil
+}
+
+func ModifyExpressions(expressions []Expression, modifier ModifierFunc) error {
+	for i, expression := range expressions {
+		modified, err := ModifyExpression(expression, modifier)
+		if err != nil {
+			return err
+		}
+		expressions[i] = modified
+	}
+	return nil
+}
+
+func ModifyStatement(statement Statement, modifier ModifierFunc) (Statement, error) {
+	modified, err := Modify(statement, modifier)
+	if err != nil {
+		return nil, err
+	}
+
+	replacement, okay := modified.(Statement)
+	if !okay {
+		return nil, Mismatch(statement, modified, "a statement")
+	}
+
+	return replacement, nil
+}
+
+func ModifyBlock(block *BlockStatement, modifier ModifierFunc) (*BlockStatement, error) {
+	if block == nil {
+		return nil, nil
+	}
+
+	modified, err := Modify(block, modifier)
+	if err != nil {
+		return nil, err
+	}
+
+	replacement, okay := modified.(*BlockStatement)
+	if !okay {
+		return nil, Mismatch(block, modified, "a block")
+	}
+
+	return replacement, nil
+}
+
+func ModifyIdentifier(identifier *Identifier, modifier ModifierFunc) (*Identifier, error) {
+	modified, err := Modify(identifier, modifier)
+	if err != nil {
+		return nil, err
+	}
 
+	replacement, okay := modified.(*Identifier)
+	if !okay {
+		return nil, Mismatch(identifier, modified, "an identifier")
 	}
 
-	return modifier(node)
-}
\ No newline at end of file
+	return replacement, nil
+}
@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"monkey/token"
 	"reflect"
 	"testing"
 )
@@ -98,7 +99,7 @@ func TestModify(t *testing.T) {
         },
         {
             &FunctionLiteral{
-                Parameters: []*Identifier{},
+                Parameters: []Expression{},
                 Body: &BlockStatement{
                     Statements: []Statement{
                         &ExpressionStatement{Expression: one()},
@@ -106,7 +107,7 @@ func TestModify(t *testing.T) {
                 },
             },
             &FunctionLiteral{
-                Parameters: []*Identifier{},
+                Parameters: []Expression{},
                 Body: &BlockStatement{
                     Statements: []Statement{
                         &ExpressionStatement{Expression: two()},
@@ -118,10 +119,63 @@ func TestModify(t *testing.T) {
             &ArrayLiteral{Elements: []Expression{one(), one()}},
             &ArrayLiteral{Elements: []Expression{two(), two()}},
         },
+        {
+            &ConditionalExpression{Condition: one(), Consequence: one(), Alternative: one()},
+            &ConditionalExpression{Condition: two(), Consequence: two(), Alternative: two()},
+        },
+        {
+            &MatchExpression{
+                Subject: one(),
+                Arms: []*MatchArm{
+                    {Pattern: one(), Guard: one(), Body: one()},
+                    {Pattern: one(), Body: one()},
+                },
+            },
+            &MatchExpression{
+                Subject: two(),
+                Arms: []*MatchArm{
+                    {Pattern: two(), Guard: two(), Body: two()},
+                    {Pattern: two(), Body: two()},
+                },
+            },
+        },
+        {
+            &SpreadExpression{Value: one()},
+            &SpreadExpression{Value: two()},
+        },
+        {
+            &CallExpression{Function: one(), Arguments: []Expression{one(), one()}},
+            &CallExpression{Function: two(), Arguments: []Expression{two(), two()}},
+        },
+        {
+            &DefaultParameter{Pattern: one(), Default: one()},
+            &DefaultParameter{Pattern: two(), Default: two()},
+        },
+        {
+            &MacroLiteral{
+                Parameters: []*Identifier{},
+                Body: &BlockStatement{
+                    Statements: []Statement{
+                        &ExpressionStatement{Expression: one()},
+                    },
+                },
+            },
+            &MacroLiteral{
+                Parameters: []*Identifier{},
+                Body: &BlockStatement{
+                    Statements: []Statement{
+                        &ExpressionStatement{Expression: two()},
+                    },
+                },
+            },
+        },
 	}
 
 	for _, tt := range tests {
-		modified := Modify(tt.input, TurnOneIntoTwo)
+		modified, err := Modify(tt.input, TurnOneIntoTwo)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
 
 		equal := reflect.DeepEqual(modified, tt.expected)
 		if !equal {
@@ -129,14 +183,22 @@ func TestModify(t *testing.T) {
 		}
 	}
 
+    KeyFirst, KeySecond := one(), one()
     hash := &HashLiteral{
         Pairs: map[Expression]Expression{
-            one(): one(),
-            one(): one(),
+            KeyFirst: one(),
+            KeySecond: one(),
         },
+        Keys: []Expression{KeyFirst, KeySecond},
+    }
+
+    if _, err := Modify(hash, TurnOneIntoTwo); err != nil {
+        t.Fatalf("unexpected error: %s", err)
     }
 
-    Modify(hash, TurnOneIntoTwo)
+    if len(hash.Keys) != 2 || len(hash.Pairs) != 2 {
+        t.Fatalf("wrong number of pairs, got keys=%d pairs=%d", len(hash.Keys), len(hash.Pairs))
+    }
 
     for key, val := range hash.Pairs {
         key, _ := key.(*IntegerLiteral)
@@ -148,4 +210,54 @@ func TestModify(t *testing.T) {
             t.Errorf("value is not %d, got=%d", 2, val.Value)
         }
     }
-}
\ No newline at end of file
+}
+
+func TestModifyErrors(t *testing.T) {
+	tests := []struct {
+		input    Node
+		modifier ModifierFunc
+		expected string
+	}{
+		{
+			&InfixExpression{OperandLeft: &IntegerLiteral{Token: token.Token{Literal: "1"}}, Operator: "+", OperandRight: &Identifier{Value: "x"}},
+			func(node Node) Node {
+				if _, okay := node.(*IntegerLiteral); okay {
+					return nil
+				}
+				return node
+			},
+			"cannot replace 1 with nil",
+		},
+		{
+			&CallExpression{Function: &Identifier{Value: "f"}, Arguments: []Expression{&Identifier{Value: "x"}}},
+			func(node Node) Node {
+				if identifier, okay := node.(*Identifier); okay && identifier.Value == "x" {
+					return &ReturnStatement{Token: token.Token{Literal: "return"}, Value: identifier}
+				}
+				return node
+			},
+			"cannot replace x with return x;: want an expression, got *ast.ReturnStatement",
+		},
+		{
+			&LetStatement{Name: &Identifier{Value: "x"}, Value: &Identifier{Value: "y"}},
+			func(node Node) Node {
+				if identifier, okay := node.(*Identifier); okay && identifier.Value == "x" {
+					return &IntegerLiteral{Token: token.Token{Literal: "1"}}
+				}
+				return node
+			},
+			"cannot replace x with 1: want an identifier, got *ast.IntegerLiteral",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := Modify(tt.input, tt.modifier)
+		if err == nil {
+			t.Errorf("expected an error modifying %s", tt.input.String())
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error, got=%q, want=%q", err.Error(), tt.expected)
+		}
+	}
+}
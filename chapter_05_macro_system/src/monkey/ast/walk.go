@@ -0,0 +1,37 @@
+package ast
+
+// Visitor is called by Walk for each node. If the visitor it returns is not
+// nil, Walk visits the children of the node with it, and then calls its
+// Visit with nil.
+type Visitor interface {
+	Visit(node Node) Visitor
+}
+
+// Walk traverses the tree in depth-first order without changing it
+func Walk(visitor Visitor, node Node) {
+	if visitor = visitor.Visit(node); visitor == nil {
+		return
+	}
+
+	for _, child := range Children(node) {
+		Walk(visitor, child)
+	}
+
+	visitor.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect calls f for each node of the tree in depth-first order, the
+// children of a node are skipped when f returns false for it. As with
+// Walk, f is called with nil after the children of a node.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
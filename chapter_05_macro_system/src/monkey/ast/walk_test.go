@@ -0,0 +1,77 @@
+package ast
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{Name: ident("a"), Value: &CallExpression{Function: ident("f"), Arguments: []Expression{ident("b"), ident("c")}}},
+			&ExpressionStatement{Expression: &MacroLiteral{
+				Parameters: []*Identifier{ident("d")},
+				Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: ident("e")}}},
+			}},
+			&ExpressionStatement{Expression: &FunctionLiteral{
+				Parameters: []Expression{ident("g")},
+				Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: ident("h")}}},
+			}},
+		},
+	}
+	before := program.String()
+
+	names := []string{}
+	Inspect(program, func(node Node) bool {
+		if _, okay := node.(*FunctionLiteral); okay {
+			return false
+		}
+		if identifier, okay := node.(*Identifier); okay {
+			names = append(names, identifier.Value)
+		}
+		return true
+	})
+
+	if strings.Join(names, " ") != "a f b c d e" {
+		t.Errorf("wrong identifiers visited, got=%v", names)
+	}
+
+	if program.String() != before {
+		t.Errorf("Inspect changed the tree, got=%q, want=%q", program.String(), before)
+	}
+}
+
+type depthVisitor struct {
+	depth int
+	max   *int
+}
+
+func (v depthVisitor) Visit(node Node) Visitor {
+	if node == nil {
+		return nil
+	}
+	if v.depth > *v.max {
+		*v.max = v.depth
+	}
+	return depthVisitor{depth: v.depth + 1, max: v.max}
+}
+
+func TestWalk(t *testing.T) {
+	max := 0
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{Expression: &PrefixExpression{
+				Operator: "-",
+				Operand:  &InfixExpression{OperandLeft: &IntegerLiteral{Value: 1}, Operator: "+", OperandRight: &IntegerLiteral{Value: 2}},
+			}},
+		},
+	}
+
+	Walk(depthVisitor{max: &max}, program)
+
+	if max != 4 {
+		t.Errorf("wrong depth, got=%d, want=%d", max, 4)
+	}
+}
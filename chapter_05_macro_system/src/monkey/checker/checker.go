@@ -0,0 +1,744 @@
+package checker
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+)
+
+// Type is a static type. A nil *Type is unknown and compatible with
+// anything, which keeps unannotated code working.
+type Type struct {
+	Name string
+
+	// known for function literals, nil entries are unknown
+	Signature bool
+	Parameters []*Type
+	Variadic bool
+	Return *Type
+}
+
+func (t *Type) String() string {
+	if t == nil {
+		return "any"
+	}
+	return t.Name
+}
+
+var (
+	INT = &Type{Name: "int"}
+	BOOL = &Type{Name: "bool"}
+	STRING = &Type{Name: "string"}
+	NULL = &Type{Name: "null"}
+	ARRAY = &Type{Name: "array"}
+	HASH = &Type{Name: "hash"}
+	FUNCTION = &Type{Name: "fn"}
+)
+
+// Types maps the names usable in annotations to their type, any is unknown
+var Types = map[string]*Type{
+	"int": INT,
+	"bool": BOOL,
+	"string": STRING,
+	"null": NULL,
+	"array": ARRAY,
+	"hash": HASH,
+	"fn": FUNCTION,
+	"any": nil,
+}
+
+// BuiltinReturns records the result type of the builtins that always
+// return the same type. first, last, rest, find and ast_name return null
+// when there is nothing to return, so they are unknown.
+var BuiltinReturns = map[string]*Type{
+	"len": INT,
+	"puts": NULL,
+	"push": ARRAY,
+	"map": ARRAY,
+	"filter": ARRAY,
+	"sort": ARRAY,
+	"reverse": ARRAY,
+	"range": ARRAY,
+	"zip": ARRAY,
+	"flat_map": ARRAY,
+	"keys": ARRAY,
+	"values": ARRAY,
+	"items": ARRAY,
+	"any": BOOL,
+	"all": BOOL,
+	"has_key": BOOL,
+	"is_frozen": BOOL,
+	"delete": HASH,
+	"merge": HASH,
+	"ast_type": STRING,
+	"ast_children": ARRAY,
+}
+
+func Compatible(have *Type, want *Type) bool {
+	return have == nil || want == nil || have.Name == want.Name
+}
+
+// Common returns the type shared by all types, or nil
+func Common(types ...*Type) *Type {
+	if len(types) == 0 || types[0] == nil {
+		return nil
+	}
+	for _, t := range types[1:] {
+		if t == nil || t.Name != types[0].Name {
+			return nil
+		}
+	}
+	return types[0]
+}
+
+type Error struct {
+	Token token.Token
+	Message string
+}
+
+func (e Error) String() string {
+	return e.Message
+}
+
+type Binding struct {
+	Type *Type
+	Annotated bool
+}
+
+// Function collects what the checker learns about the function being checked
+type Function struct {
+	Name string
+	Declared *Type
+	Returned []*Type
+	Scope int	// index of the scope of its parameters
+}
+
+// Checker infers types where it can and reports the operations that would
+// fail at run time whatever path leads to them
+type Checker struct {
+	scopes []map[string]*Binding
+	functions []*Function
+	conditional int	// > 0 within branches that may not run
+	rebound map[string]bool	// names bound more than once
+	errors []Error
+}
+
+func NewChecker() *Checker {
+	return &Checker{scopes: []map[string]*Binding{{}}}
+}
+
+// Copy returns a checker with the global bindings of c, which checking
+// with the copy leaves unchanged
+func (c *Checker) Copy() *Checker {
+	globals := map[string]*Binding{}
+	for name, binding := range c.scopes[0] {
+		globals[name] = binding
+	}
+	return &Checker{scopes: []map[string]*Binding{globals}}
+}
+
+// Check reports the errors in program. Top level bindings are kept for the
+// next programs checked, as the REPL checks a line at a time.
+func (c *Checker) Check(program *ast.Program) []Error {
+	c.errors = []Error{}
+	c.rebound = Rebound(program, c.scopes[0])
+
+	c.CheckNode(program)
+
+	return c.errors
+}
+
+func (c *Checker) CheckNode(node ast.Node) *Type {
+	switch node := node.(type) {
+	case *ast.Program:
+		return c.CheckStatements(node.Statements)
+
+	case *ast.BlockStatement:
+		return c.CheckStatements(node.Statements)
+
+	case *ast.ExpressionStatement:
+		return c.CheckNode(node.Expression)
+
+	case *ast.ReturnStatement:
+		c.CheckReturn(node)
+		return nil
+
+	case *ast.LetStatement:
+		c.CheckLetStatement(node)
+		return nil
+
+	case *ast.InfixDeclaration:
+		c.CheckLetStatement(&ast.LetStatement{Token: node.Token, Name: node.Name, Value: node.Function})
+		return nil
+
+	case *ast.Identifier:
+		if binding := c.Lookup(node.Value); binding != nil {
+			// a function may run after the names it captures are rebound
+			if !binding.Annotated && c.rebound[node.Value] && c.Captured(node.Value) {
+				return nil
+			}
+			return binding.Type
+		}
+		return nil
+
+	case *ast.IntegerLiteral:
+		return INT
+
+	case *ast.Boolean:
+		return BOOL
+
+	case *ast.StringLiteral:
+		return STRING
+
+	case *ast.NullLiteral:
+		return NULL
+
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			c.CheckNode(element)
+		}
+		return ARRAY
+
+	case *ast.HashLiteral:
+		for _, key := range node.Keys {
+			c.CheckNode(key)
+			c.CheckNode(node.Pairs[key])
+		}
+		return HASH
+
+	case *ast.PrefixExpression:
+		return c.CheckPrefixExpression(node)
+
+	case *ast.InfixExpression:
+		return c.CheckInfixExpression(node)
+
+	case *ast.IfExpression:
+		c.CheckNode(node.Condition)
+		c.conditional += 1
+		consequence := c.CheckNode(node.Consequence)
+		if node.Alternative == nil {
+			c.conditional -= 1
+			return nil
+		}
+		alternative := c.CheckNode(node.Alternative)
+		c.conditional -= 1
+		return Common(consequence, alternative)
+
+	case *ast.ConditionalExpression:
+		c.CheckNode(node.Condition)
+		c.conditional += 1
+		consequence := c.CheckNode(node.Consequence)
+		alternative := c.CheckNode(node.Alternative)
+		c.conditional -= 1
+		return Common(consequence, alternative)
+
+	case *ast.MatchExpression:
+		return c.CheckMatchExpression(node)
+
+	case *ast.IndexExpression:
+		left := c.CheckNode(node.Array)
+		c.CheckNode(node.Index)
+		if left != nil && left != ARRAY && left != HASH && !(node.Optional && left == NULL) {
+			c.Report(node.Token, "index operator not supported: %s", left)
+		}
+		return nil
+
+	case *ast.SpreadExpression:
+		if value := c.CheckNode(node.Value); !Compatible(value, ARRAY) {
+			c.Report(node.Token, "spread operator requires array, got %s", value)
+		}
+		return nil
+
+	case *ast.CallExpression:
+		return c.CheckCallExpression(node)
+
+	case *ast.FunctionLiteral:
+		return c.CheckFunctionLiteral(node)
+	}
+
+	return nil
+}
+
+// CheckStatements returns the type of the last statement if it is an
+// expression, the value of the block
+func (c *Checker) CheckStatements(statements []ast.Statement) *Type {
+	var result *Type
+
+	for _, stmt := range statements {
+		result = c.CheckNode(stmt)
+	}
+
+	if len(statements) == 0 {
+		return nil
+	}
+	if _, okay := statements[len(statements) - 1].(*ast.ExpressionStatement); !okay {
+		return nil
+	}
+
+	return result
+}
+
+func (c *Checker) CheckLetStatement(let *ast.LetStatement) {
+	declared := c.Annotation(let.Type)
+
+	var value *Type
+	if fl, okay := let.Value.(*ast.FunctionLiteral); okay && let.Name != nil {
+		// bound to its signature first, so that recursive calls are checked
+		c.Declare(let.Name.Value, c.Signature(fl), declared != nil)
+		value = c.CheckFunctionLiteral(fl)
+	} else {
+		value = c.CheckNode(let.Value)
+	}
+
+	target := let.TokenLiteral() + " "
+	if let.Pattern != nil {
+		target += let.Pattern.String()
+	} else {
+		target += let.Name.Value
+	}
+
+	if !Compatible(value, declared) {
+		c.Report(let.Token, "cannot use %s as %s in %s", value, declared, target)
+	}
+
+	if let.Pattern != nil {
+		c.CheckDestructuring(let.Token, let.Pattern, value)
+		c.DeclarePattern(let.Pattern, nil)
+		return
+	}
+
+	if declared != nil {
+		c.Declare(let.Name.Value, declared, true)
+		return
+	}
+
+	if binding, okay := c.scopes[len(c.scopes) - 1][let.Name.Value]; okay {
+		if binding.Annotated {
+			if !Compatible(value, binding.Type) {
+				c.Report(let.Token, "cannot use %s as %s in %s", value, binding.Type, target)
+			}
+			return
+		}
+		if c.conditional > 0 && (value == nil || binding.Type == nil || value.Name != binding.Type.Name) {
+			// the branch may not run, so the name has either type
+			value = nil
+		}
+	}
+
+	c.Declare(let.Name.Value, value, false)
+}
+
+func (c *Checker) CheckDestructuring(tok token.Token, pattern ast.Expression, value *Type) {
+	switch pattern.(type) {
+	case *ast.ArrayLiteral:
+		if !Compatible(value, ARRAY) {
+			c.Report(tok, "cannot destructure %s as array", value)
+		}
+	case *ast.HashLiteral:
+		if !Compatible(value, HASH) {
+			c.Report(tok, "cannot destructure %s as hash", value)
+		}
+	}
+}
+
+func (c *Checker) CheckReturn(rs *ast.ReturnStatement) {
+	value := c.CheckNode(rs.Value)
+
+	if len(c.functions) == 0 {
+		return
+	}
+
+	function := c.functions[len(c.functions) - 1]
+	function.Returned = append(function.Returned, value)
+
+	if !Compatible(value, function.Declared) {
+		c.Report(rs.Token, "cannot use %s as %s in return from %s", value, function.Declared, function.Name)
+	}
+}
+
+func (c *Checker) CheckPrefixExpression(pe *ast.PrefixExpression) *Type {
+	operand := c.CheckNode(pe.Operand)
+
+	switch pe.Operator {
+	case "!":
+		return BOOL
+	case "-", "~":
+		if !Compatible(operand, INT) {
+			c.Report(pe.Token, "unknown operator: %s%s", pe.Operator, operand)
+		}
+		return INT
+	}
+
+	return nil
+}
+
+func (c *Checker) CheckInfixExpression(ie *ast.InfixExpression) *Type {
+	if ie.Function != nil {
+		// a declared operator is a call of its function
+		return c.CheckCallExpression(&ast.CallExpression{
+			Token:     ie.Token,
+			Function:  ie.Function,
+			Arguments: []ast.Expression{ie.OperandLeft, ie.OperandRight},
+		})
+	}
+
+	if ie.Operator == "|>" {
+		return c.CheckCallExpression(PipelineCall(ie))
+	}
+
+	left := c.CheckNode(ie.OperandLeft)
+	right := c.CheckNode(ie.OperandRight)
+
+	switch ie.Operator {
+	case "==", "!=":
+		return BOOL
+	case ">>>":
+		return c.CheckComposition(ie.Token, left, right)
+	case "??":
+		if left == NULL {
+			return right
+		}
+		if left != nil {
+			return left
+		}
+		return Common(left, right)
+	}
+
+	if left != nil && right != nil {
+		switch {
+		case left == INT && right == INT:
+			// every other operator works on integers
+		case left == STRING && right == STRING && ie.Operator == "+":
+			return STRING
+		case left.Name != right.Name:
+			c.Report(ie.Token, "type mismatch: %s %s %s", left, ie.Operator, right)
+			return nil
+		default:
+			c.Report(ie.Token, "unknown operator: %s %s %s", left, ie.Operator, right)
+			return nil
+		}
+	}
+
+	switch ie.Operator {
+	case "<", ">":
+		return BOOL
+	case "+":
+		return Common(left, right)
+	}
+
+	return INT
+}
+
+// PipelineCall returns the call a |> expression makes, the left operand
+// becomes the first argument of the call on the right
+func PipelineCall(ie *ast.InfixExpression) *ast.CallExpression {
+	if call, okay := ie.OperandRight.(*ast.CallExpression); okay {
+		return &ast.CallExpression{
+			Token:     call.Token,
+			Function:  call.Function,
+			Arguments: append([]ast.Expression{ie.OperandLeft}, call.Arguments...),
+		}
+	}
+	return &ast.CallExpression{Token: ie.Token, Function: ie.OperandRight, Arguments: []ast.Expression{ie.OperandLeft}}
+}
+
+// CheckComposition returns the type of first >>> second, which takes the
+// parameters of first and returns what second does
+func (c *Checker) CheckComposition(tok token.Token, first *Type, second *Type) *Type {
+	for _, operand := range []*Type{first, second} {
+		if operand != nil && operand.Name != FUNCTION.Name {
+			c.Report(tok, "cannot compose %s, it is not a function", operand)
+			return nil
+		}
+	}
+
+	if first == nil || second == nil || !first.Signature || !second.Signature {
+		return FUNCTION
+	}
+
+	return &Type{Name: FUNCTION.Name, Signature: true, Parameters: first.Parameters, Variadic: first.Variadic, Return: second.Return}
+}
+
+func (c *Checker) CheckMatchExpression(me *ast.MatchExpression) *Type {
+	c.CheckNode(me.Subject)
+
+	results := []*Type{}
+	c.conditional += 1
+
+	for _, arm := range me.Arms {
+		c.PushScope()
+		c.DeclarePattern(arm.Pattern, nil)
+		if arm.Guard != nil {
+			c.CheckNode(arm.Guard)
+		}
+		results = append(results, c.CheckNode(arm.Body))
+		c.PopScope()
+	}
+
+	c.conditional -= 1
+
+	// without a final catch all arm, no match evaluates to null
+	if len(me.Arms) == 0 {
+		return nil
+	}
+	if _, okay := me.Arms[len(me.Arms) - 1].Pattern.(*ast.Identifier); !okay {
+		return nil
+	}
+
+	return Common(results...)
+}
+
+func (c *Checker) CheckCallExpression(ce *ast.CallExpression) *Type {
+	// quoted code is data until it is expanded
+	if ce.Function.TokenLiteral() == "quote" {
+		return nil
+	}
+
+	callee := c.CheckNode(ce.Function)
+
+	arguments := []*Type{}
+	spread := false
+	for _, arg := range ce.Arguments {
+		t := c.CheckNode(arg)
+		if _, okay := arg.(*ast.SpreadExpression); okay {
+			spread = true
+		}
+		if !spread {
+			arguments = append(arguments, t)
+		}
+	}
+
+	name := "anonymous function"
+	if identifier, okay := ce.Function.(*ast.Identifier); okay {
+		name = identifier.Value
+		if c.Lookup(name) == nil {
+			return BuiltinReturns[name]
+		}
+	}
+
+	if callee == nil {
+		return nil
+	}
+
+	if callee.Name != FUNCTION.Name {
+		c.Report(ce.Token, "not a function: %s", callee)
+		return nil
+	}
+
+	if !callee.Signature {
+		return nil
+	}
+
+	for i, argument := range arguments {
+		if i >= len(callee.Parameters) || (callee.Variadic && i >= len(callee.Parameters) - 1) {
+			break
+		}
+		if !Compatible(argument, callee.Parameters[i]) {
+			c.Report(ce.Token, "cannot use %s as %s in argument %d to %s", argument, callee.Parameters[i], i + 1, name)
+		}
+	}
+
+	return callee.Return
+}
+
+// Signature builds the type of a function literal from its annotations
+func (c *Checker) Signature(fl *ast.FunctionLiteral) *Type {
+	function := &Type{Name: FUNCTION.Name, Signature: true, Parameters: []*Type{}}
+
+	for i, param := range fl.Parameters {
+		var t *Type
+		if i < len(fl.ParameterTypes) && fl.ParameterTypes[i] != nil {
+			t = Types[fl.ParameterTypes[i].Name]
+		}
+		function.Parameters = append(function.Parameters, t)
+
+		if _, okay := param.(*ast.SpreadExpression); okay {
+			function.Variadic = true
+		}
+	}
+
+	if fl.ReturnType != nil {
+		function.Return = Types[fl.ReturnType.Name]
+	}
+
+	return function
+}
+
+// CheckFunctionLiteral checks parameter defaults and the body, and infers
+// the return type when it is not annotated
+func (c *Checker) CheckFunctionLiteral(fl *ast.FunctionLiteral) *Type {
+	signature := c.Signature(fl)
+
+	for _, annotation := range fl.ParameterTypes {
+		c.Annotation(annotation)
+	}
+	declared := c.Annotation(fl.ReturnType)
+
+	name := fl.Name
+	if name == "" {
+		name = "anonymous function"
+	}
+	function := &Function{Name: name, Declared: declared, Scope: len(c.scopes)}
+
+	c.PushScope()
+	c.functions = append(c.functions, function)
+	saved := c.conditional
+	c.conditional = 0
+
+	for i, param := range fl.Parameters {
+		t := signature.Parameters[i]
+
+		switch param := param.(type) {
+		case *ast.DefaultParameter:
+			value := c.CheckNode(param.Default)
+			if !Compatible(value, t) {
+				c.Report(param.Token, "cannot use %s as %s in default of %s", value, t, param.Pattern.String())
+			}
+			c.DeclareParameter(param.Pattern, t)
+		case *ast.SpreadExpression:
+			if t == nil {
+				t = ARRAY
+			}
+			c.DeclareParameter(param.Value, t)
+		default:
+			c.DeclareParameter(param, t)
+		}
+	}
+
+	body := c.CheckNode(fl.Body)
+	last := len(fl.Body.Statements) - 1
+	if last >= 0 {
+		if _, okay := fl.Body.Statements[last].(*ast.ExpressionStatement); okay {
+			function.Returned = append(function.Returned, body)
+			if !Compatible(body, declared) {
+				c.Report(fl.ReturnType.Token, "cannot use %s as %s in return from %s", body, declared, name)
+			}
+		}
+	}
+
+	c.conditional = saved
+	c.functions = c.functions[:len(c.functions) - 1]
+	c.PopScope()
+
+	if declared == nil {
+		signature.Return = Common(function.Returned...)
+	}
+
+	return signature
+}
+
+func (c *Checker) DeclareParameter(pattern ast.Expression, t *Type) {
+	if identifier, okay := pattern.(*ast.Identifier); okay {
+		c.Declare(identifier.Value, t, t != nil)
+		return
+	}
+	c.DeclarePattern(pattern, nil)
+}
+
+// DeclarePattern binds the identifiers of a pattern, their types are unknown
+func (c *Checker) DeclarePattern(pattern ast.Expression, t *Type) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			c.Declare(pattern.Value, t, false)
+		}
+	case *ast.ArrayLiteral:
+		for _, element := range pattern.Elements {
+			if spread, okay := element.(*ast.SpreadExpression); okay {
+				element = spread.Value
+			}
+			c.DeclarePattern(element, nil)
+		}
+	case *ast.HashLiteral:
+		for _, key := range pattern.Keys {
+			c.DeclarePattern(pattern.Pairs[key], nil)
+		}
+	}
+}
+
+// Annotation returns the type named by annotation, reporting unknown names
+func (c *Checker) Annotation(annotation *ast.TypeAnnotation) *Type {
+	if annotation == nil {
+		return nil
+	}
+
+	t, okay := Types[annotation.Name]
+	if !okay {
+		c.Report(annotation.Token, "unknown type: %s", annotation.Name)
+	}
+	return t
+}
+
+func (c *Checker) PushScope() {
+	c.scopes = append(c.scopes, map[string]*Binding{})
+}
+
+func (c *Checker) PopScope() {
+	c.scopes = c.scopes[:len(c.scopes) - 1]
+}
+
+func (c *Checker) Declare(name string, t *Type, annotated bool) {
+	c.scopes[len(c.scopes) - 1][name] = &Binding{Type: t, Annotated: annotated}
+}
+
+func (c *Checker) Lookup(name string) *Binding {
+	for i := len(c.scopes) - 1; i >= 0; i -= 1 {
+		if binding, okay := c.scopes[i][name]; okay {
+			return binding
+		}
+	}
+	return nil
+}
+
+// Captured reports whether name is bound outside the function being checked
+func (c *Checker) Captured(name string) bool {
+	if len(c.functions) == 0 {
+		return false
+	}
+	for i := len(c.scopes) - 1; i >= 0; i -= 1 {
+		if _, okay := c.scopes[i][name]; okay {
+			return i < c.functions[len(c.functions) - 1].Scope
+		}
+	}
+	return false
+}
+
+// Rebound returns the names program binds more than once, counting the
+// bindings of globals left by the programs checked before
+func Rebound(program *ast.Program, globals map[string]*Binding) map[string]bool {
+	count := map[string]int{}
+	for name := range globals {
+		count[name] = 1
+	}
+
+	rebound := map[string]bool{}
+	bind := func(node ast.Node) {
+		ast.Inspect(node, func(node ast.Node) bool {
+			if identifier, okay := node.(*ast.Identifier); okay {
+				count[identifier.Value] += 1
+				rebound[identifier.Value] = count[identifier.Value] > 1
+			}
+			return true
+		})
+	}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if node.Pattern != nil {
+				bind(node.Pattern)
+			} else {
+				bind(node.Name)
+			}
+		case *ast.InfixDeclaration:
+			bind(node.Name)
+		}
+		return true
+	})
+
+	return rebound
+}
+
+func (c *Checker) Report(tok token.Token, format string, a ...interface{}) {
+	c.errors = append(c.errors, Error{Token: tok, Message: fmt.Sprintf(format, a...)})
+}
@@ -0,0 +1,117 @@
+package checker
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func CheckProgram(t *testing.T, input string) []Error {
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+
+	if len(p.GetErrors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.GetErrors())
+	}
+
+	return NewChecker().Check(program)
+}
+
+func TestChecker(t *testing.T) {
+	tests := []struct {
+		input string
+		expected []string
+	}{
+		// unannotated code
+		{ `let x = 5; let y = x * 2; y + 1`, []string{} },
+		{ `let f = fn(x) { x + 1 }; f("a")`, []string{} },
+		{ `let x = 1; let x = "a"; x + "b"`, []string{} },
+		{ `5 + "a"`, []string{"type mismatch: int + string"} },
+		{ `let x = 5; let s = "a"; if (x > 1) { s - x }`, []string{"type mismatch: string - int"} },
+		{ `"a" - "b"`, []string{"unknown operator: string - string"} },
+		{ `true + false`, []string{"unknown operator: bool + bool"} },
+		{ `-"a"`, []string{"unknown operator: -string"} },
+		{ `let x = 5; x[0]`, []string{"index operator not supported: int"} },
+		{ `let x = null; x?[0]`, []string{} },
+		{ `let x = null; x?[0]["a"](1)`, []string{} },
+		{ `let x = 5; x(1)`, []string{"not a function: int"} },
+		{ `len("abc") + 1`, []string{} },
+		{ `len("abc") + "a"`, []string{"type mismatch: int + string"} },
+		{ `let r: null = rest([]);`, []string{} },
+		{ `let r: array = rest([1]) ?? [];`, []string{} },
+		{ `let x: int = first([]) ?? 0;`, []string{} },
+		{ `let ks: int = keys({});`, []string{"cannot use array as int in let ks"} },
+		{ `let len = fn() { "a" }; len() + "b"`, []string{} },
+		{ `let f = fn(x) { "s" }; f(1) - 1`, []string{"type mismatch: string - int"} },
+		{ `let f = fn(x) { if (x) { return 1 }; "s" }; f(1) - 1`, []string{} },
+		{ `let x = 1; if (true) { let x = "a" }; x + 1`, []string{} },
+		{ `let x = 1; let f = fn() { x + "a" }; let x = "b"; f()`, []string{} },
+		{ `let x = 1; let f = fn() { x + "a" }; let [x] = ["b"]; f()`, []string{} },
+		{ `let x = 1; let f = fn() { x + "a" }; f()`, []string{"type mismatch: int + string"} },
+		{ `let x = 1; let x = "b"; x - 1`, []string{"type mismatch: string - int"} },
+		{ `let x: int = 1; let f = fn() { x + "a" }; let x = 2;`, []string{"type mismatch: int + string"} },
+		{ `let [a, b] = 5;`, []string{"cannot destructure int as array"} },
+		{ `let {a} = [1];`, []string{"cannot destructure array as hash"} },
+		{ `match (1) { n => n + 1, _ => "a" }`, []string{} },
+		{ `quote(1 + "a")`, []string{} },
+		{ `let f = fn(x: int, y: string) -> bool { x > 0 }; 1 |> f("a")`, []string{} },
+		{ `let f = fn(x: int, y: string) -> bool { x > 0 }; "a" |> f(1)`, []string{"cannot use string as int in argument 1 to f", "cannot use int as string in argument 2 to f"} },
+		{ `let f = fn(x: int) -> string { "s" }; (1 |> f) - 1`, []string{"type mismatch: string - int"} },
+		{ `1 |> 2`, []string{"not a function: int"} },
+		{ `let f = fn(x: int) -> int { x }; let g = fn(x: int) -> string { "s" }; (f >>> g)(1) + 1`, []string{"type mismatch: string + int"} },
+		{ `let f = fn(x: int) -> int { x }; (f >>> f)("a")`, []string{"cannot use string as int in argument 1 to anonymous function"} },
+		{ `let f = fn(x) { x }; f >>> 1`, []string{"cannot compose int, it is not a function"} },
+		{ `infix <> 3 = fn(a: int, b: int) -> int { a + b }; 1 <> 2`, []string{} },
+		{ `infix <> 3 = fn(a: int, b: int) -> int { a + b }; 1 <> "a"`, []string{"cannot use string as int in argument 2 to infix <>"} },
+		{ `infix <> 3 = fn(a, b) -> string { "s" }; (1 <> 2) - 1`, []string{"type mismatch: string - int"} },
+
+		// annotations
+		{ `let x: int = 5; x + 1`, []string{} },
+		{ `let x: int = "five";`, []string{"cannot use string as int in let x"} },
+		{ `let x: int = 5; let x = "a";`, []string{"cannot use string as int in let x"} },
+		{ `let f = fn() { let x = "a"; x }; let x: int = f();`, []string{"cannot use string as int in let x"} },
+		{ `let x: any = 5; let y: int = x;`, []string{} },
+		{ `let x: number = 5;`, []string{"unknown type: number"} },
+		{ `let f = fn(x: int, y: string) -> bool { x > 0 }; f(1, "a")`, []string{} },
+		{ `let f = fn(x: int, y: string) -> bool { x > 0 }; f("a", 1)`, []string{"cannot use string as int in argument 1 to f", "cannot use int as string in argument 2 to f"} },
+		{ `let f = fn(x: int) { x + "a" };`, []string{"type mismatch: int + string"} },
+		{ `let f = fn(x: int) -> string { x };`, []string{"cannot use int as string in return from f"} },
+		{ `let f = fn(x: int) -> string { if (x > 0) { return 1 }; "a" };`, []string{"cannot use int as string in return from f"} },
+		{ `let f = fn() -> bool { true }; f() + 1`, []string{"type mismatch: bool + int"} },
+		{ `let f = fn(n: int) -> int { if (n < 2) { 1 } else { n * f("a") } };`, []string{"cannot use string as int in argument 1 to f"} },
+		{ `let f = fn(x: int = "a") { x };`, []string{"cannot use string as int in default of x"} },
+		{ `let f = fn(x: int, ...rest: array) { rest }; f(1, "a", true)`, []string{} },
+		{ `let f = fn(...rest) { rest + 1 };`, []string{"type mismatch: array + int"} },
+		{ `let f = fn(x: int) { x }; f(...["a"])`, []string{} },
+		{ `let f: fn = fn(x) { x }; let g: int = f;`, []string{"cannot use fn as int in let g"} },
+		{ `let f = fn(x: int) { let x = "a"; x };`, []string{"cannot use string as int in let x"} },
+	}
+
+	for _, tt := range tests {
+		errors := CheckProgram(t, tt.input)
+
+		if len(errors) != len(tt.expected) {
+			t.Errorf("wrong number of errors for %q, got=%v, want=%v", tt.input, errors, tt.expected)
+			continue
+		}
+
+		for i, err := range errors {
+			if err.String() != tt.expected[i] {
+				t.Errorf("wrong error for %q, got=%q, want=%q", tt.input, err.String(), tt.expected[i])
+			}
+		}
+	}
+}
+
+func TestRebindingAcrossPrograms(t *testing.T) {
+	c := NewChecker()
+
+	for _, input := range []string{`let x = 1;`, `let f = fn() { x + "a" }; let x = "b"; f()`} {
+		p := parser.NewParser(lexer.NewLexer(input))
+		program := p.ParseProgram()
+
+		if errors := c.Check(program); len(errors) != 0 {
+			t.Errorf("unexpected errors for %q: %v", input, errors)
+		}
+	}
+}
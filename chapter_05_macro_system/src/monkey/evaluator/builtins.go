@@ -2,12 +2,15 @@ package evaluator
 
 import (
 	"fmt"
+	"monkey/ast"
 	"monkey/object"
+	"monkey/token"
+	"sort"
 )
 
 var builtins = map[string]*object.Builtin {
 	"len": &object.Builtin{
-		Func: func(args ...object.Object) object.Object {
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return NewError("wrong number of arguments, got=%d, want=1", len(args))
 			}
@@ -17,13 +20,15 @@ var builtins = map[string]*object.Builtin {
 				return &object.Integer{Value: int64(len(arg.Value))}
 			case *object.Array:
 				return &object.Integer{Value: int64(len(arg.Elements))}
+			case *object.Hash:
+				return &object.Integer{Value: int64(len(arg.Pairs))}
 			default:
 				return NewError("argument to len not supported, got %s", args[0].Type())
 			}
 		},
 	},
 	"first": &object.Builtin{
-		Func: func(args ...object.Object) object.Object {
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return NewError("wrong number of arguments, got=%d, want=1", len(args))
 			}
@@ -41,7 +46,7 @@ var builtins = map[string]*object.Builtin {
 		},
 	},
 	"last": &object.Builtin{
-		Func: func(args ...object.Object) object.Object {
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return NewError("wrong number of arguments, got=%d, want=1", len(args))
 			}
@@ -60,7 +65,7 @@ var builtins = map[string]*object.Builtin {
 		},
 	},
 	"rest": &object.Builtin{
-		Func: func(args ...object.Object) object.Object {
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
 			if len(args) != 1 {
 				return NewError("wrong number of arguments, got=%d, want=1", len(args))
 			}
@@ -81,7 +86,7 @@ var builtins = map[string]*object.Builtin {
 		},
 	},
 	"push": &object.Builtin{
-		Func: func(args ...object.Object) object.Object {
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
 			if len(args) != 2 {
 				return NewError("wrong number of arguments, got=%d, want=2", len(args))
 			}
@@ -101,11 +106,643 @@ var builtins = map[string]*object.Builtin {
 		},
 	},
 	"puts": &object.Builtin{
-		Func: func(args ...object.Object) object.Object {
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
 			for _, arg := range args {
 				fmt.Println(arg.Inspect())
 			}
 			return NULL
 		},
 	},
-}
\ No newline at end of file
+	"map": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return NewError("wrong number of arguments, got=%d, want=2", len(args))
+			}
+
+			if args[0].Type() != object.ARRAY_OBJ {
+				return NewError("builtin map first argument must be ARRAY, got %s", args[0].Type())
+			}
+
+			array := args[0].(*object.Array)
+			elements := make([]object.Object, len(array.Elements))
+
+			for i, element := range array.Elements {
+				result := call(args[1], []object.Object{element})
+				if IsError(result) {
+					return result
+				}
+				elements[i] = result
+			}
+
+			return &object.Array{Elements: elements}
+		},
+	},
+	"filter": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return NewError("wrong number of arguments, got=%d, want=2", len(args))
+			}
+
+			if args[0].Type() != object.ARRAY_OBJ {
+				return NewError("builtin filter first argument must be ARRAY, got %s", args[0].Type())
+			}
+
+			array := args[0].(*object.Array)
+			elements := []object.Object{}
+
+			for _, element := range array.Elements {
+				result := call(args[1], []object.Object{element})
+				if IsError(result) {
+					return result
+				}
+				if IsTruthy(result) {
+					elements = append(elements, element)
+				}
+			}
+
+			return &object.Array{Elements: elements}
+		},
+	},
+	"reduce": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 3 {
+				return NewError("wrong number of arguments, got=%d, want=3", len(args))
+			}
+
+			if args[0].Type() != object.ARRAY_OBJ {
+				return NewError("builtin reduce first argument must be ARRAY, got %s", args[0].Type())
+			}
+
+			array := args[0].(*object.Array)
+			value := args[1]
+
+			for _, element := range array.Elements {
+				value = call(args[2], []object.Object{value, element})
+				if IsError(value) {
+					return value
+				}
+			}
+
+			return value
+		},
+	},
+	"sort": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 1 && len(args) != 2 {
+				return NewError("wrong number of arguments, got=%d, want=1 or 2", len(args))
+			}
+
+			if args[0].Type() != object.ARRAY_OBJ {
+				return NewError("builtin sort first argument must be ARRAY, got %s", args[0].Type())
+			}
+
+			array := args[0].(*object.Array)
+			elements := make([]object.Object, len(array.Elements))
+			copy(elements, array.Elements)
+
+			var err object.Object
+
+			less := func(a, b object.Object) bool {
+				var result object.Object
+				if len(args) == 2 {
+					result = call(args[1], []object.Object{a, b})
+				} else if a.Type() == object.STRING_OBJ && b.Type() == object.STRING_OBJ {
+					result = BoolToBoolean(a.(*object.String).Value < b.(*object.String).Value)
+				} else {
+					result = EvalInfixExpression("<", a, b)
+				}
+
+				switch result := result.(type) {
+				case *object.Boolean:
+					return result.Value
+				case *object.Integer:
+					return result.Sign() < 0
+				case *object.Error:
+					err = result
+				default:
+					err = NewError("builtin sort comparator must return BOOLEAN or INTEGER, got %s", result.Type())
+				}
+				return false
+			}
+
+			sort.SliceStable(elements, func(i, j int) bool {
+				if err != nil {
+					return false
+				}
+				return less(elements[i], elements[j])
+			})
+
+			if err != nil {
+				return err
+			}
+
+			return &object.Array{Elements: elements}
+		},
+	},
+	"reverse": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError("wrong number of arguments, got=%d, want=1", len(args))
+			}
+
+			if args[0].Type() != object.ARRAY_OBJ {
+				return NewError("builtin reverse argument must be ARRAY, got %s", args[0].Type())
+			}
+
+			array := args[0].(*object.Array)
+			size := len(array.Elements)
+			elements := make([]object.Object, size)
+
+			for i, element := range array.Elements {
+				elements[size - 1 - i] = element
+			}
+
+			return &object.Array{Elements: elements}
+		},
+	},
+	"range": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) < 1 || len(args) > 3 {
+				return NewError("wrong number of arguments, got=%d, want=1 to 3", len(args))
+			}
+
+			bounds := []int64{}
+			for _, arg := range args {
+				integer, okay := arg.(*object.Integer)
+				if !okay {
+					return NewError("builtin range arguments must be INTEGER, got %s", arg.Type())
+				}
+				if integer.IsBig() {
+					return NewError("builtin range argument out of range: %s", integer.Inspect())
+				}
+				bounds = append(bounds, integer.Value)
+			}
+
+			start, stop, step := int64(0), bounds[0], int64(1)
+			if len(bounds) > 1 {
+				start, stop = bounds[0], bounds[1]
+			}
+			if len(bounds) > 2 {
+				step = bounds[2]
+			}
+
+			if step == 0 {
+				return NewError("builtin range step must not be zero")
+			}
+
+			elements := []object.Object{}
+			for i := start; (step > 0 && i < stop) || (step < 0 && i > stop); i += step {
+				elements = append(elements, &object.Integer{Value: i})
+			}
+
+			return &object.Array{Elements: elements}
+		},
+	},
+	"zip": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) < 2 {
+				return NewError("wrong number of arguments, got=%d, want at least 2", len(args))
+			}
+
+			arrays := []*object.Array{}
+			size := -1
+
+			for _, arg := range args {
+				array, okay := arg.(*object.Array)
+				if !okay {
+					return NewError("builtin zip arguments must be ARRAY, got %s", arg.Type())
+				}
+				if size < 0 || len(array.Elements) < size {
+					size = len(array.Elements)
+				}
+				arrays = append(arrays, array)
+			}
+
+			elements := make([]object.Object, size)
+			for i := 0; i < size; i++ {
+				tuple := make([]object.Object, len(arrays))
+				for j, array := range arrays {
+					tuple[j] = array.Elements[i]
+				}
+				elements[i] = &object.Array{Elements: tuple}
+			}
+
+			return &object.Array{Elements: elements}
+		},
+	},
+	"any": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return NewError("wrong number of arguments, got=%d, want=2", len(args))
+			}
+
+			if args[0].Type() != object.ARRAY_OBJ {
+				return NewError("builtin any first argument must be ARRAY, got %s", args[0].Type())
+			}
+
+			for _, element := range args[0].(*object.Array).Elements {
+				result := call(args[1], []object.Object{element})
+				if IsError(result) {
+					return result
+				}
+				if IsTruthy(result) {
+					return TRUE
+				}
+			}
+
+			return FALSE
+		},
+	},
+	"all": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return NewError("wrong number of arguments, got=%d, want=2", len(args))
+			}
+
+			if args[0].Type() != object.ARRAY_OBJ {
+				return NewError("builtin all first argument must be ARRAY, got %s", args[0].Type())
+			}
+
+			for _, element := range args[0].(*object.Array).Elements {
+				result := call(args[1], []object.Object{element})
+				if IsError(result) {
+					return result
+				}
+				if !IsTruthy(result) {
+					return FALSE
+				}
+			}
+
+			return TRUE
+		},
+	},
+	"find": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return NewError("wrong number of arguments, got=%d, want=2", len(args))
+			}
+
+			if args[0].Type() != object.ARRAY_OBJ {
+				return NewError("builtin find first argument must be ARRAY, got %s", args[0].Type())
+			}
+
+			for _, element := range args[0].(*object.Array).Elements {
+				result := call(args[1], []object.Object{element})
+				if IsError(result) {
+					return result
+				}
+				if IsTruthy(result) {
+					return element
+				}
+			}
+
+			return NULL
+		},
+	},
+	"flat_map": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return NewError("wrong number of arguments, got=%d, want=2", len(args))
+			}
+
+			if args[0].Type() != object.ARRAY_OBJ {
+				return NewError("builtin flat_map first argument must be ARRAY, got %s", args[0].Type())
+			}
+
+			elements := []object.Object{}
+
+			for _, element := range args[0].(*object.Array).Elements {
+				result := call(args[1], []object.Object{element})
+				if IsError(result) {
+					return result
+				}
+
+				array, okay := result.(*object.Array)
+				if !okay {
+					return NewError("builtin flat_map function must return ARRAY, got %s", result.Type())
+				}
+				elements = append(elements, array.Elements...)
+			}
+
+			return &object.Array{Elements: elements}
+		},
+	},
+	"keys": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError("wrong number of arguments, got=%d, want=1", len(args))
+			}
+
+			if args[0].Type() != object.HASH_OBJ {
+				return NewError("builtin keys argument must be HASH, got %s", args[0].Type())
+			}
+
+			elements := []object.Object{}
+			for _, pair := range args[0].(*object.Hash).Pairs {
+				elements = append(elements, pair.Key)
+			}
+
+			return &object.Array{Elements: elements}
+		},
+	},
+	"values": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError("wrong number of arguments, got=%d, want=1", len(args))
+			}
+
+			if args[0].Type() != object.HASH_OBJ {
+				return NewError("builtin values argument must be HASH, got %s", args[0].Type())
+			}
+
+			elements := []object.Object{}
+			for _, pair := range args[0].(*object.Hash).Pairs {
+				elements = append(elements, pair.Value)
+			}
+
+			return &object.Array{Elements: elements}
+		},
+	},
+	"items": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError("wrong number of arguments, got=%d, want=1", len(args))
+			}
+
+			if args[0].Type() != object.HASH_OBJ {
+				return NewError("builtin items argument must be HASH, got %s", args[0].Type())
+			}
+
+			elements := []object.Object{}
+			for _, pair := range args[0].(*object.Hash).Pairs {
+				item := &object.Array{Elements: []object.Object{pair.Key, pair.Value}}
+				elements = append(elements, item)
+			}
+
+			return &object.Array{Elements: elements}
+		},
+	},
+	"has_key": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return NewError("wrong number of arguments, got=%d, want=2", len(args))
+			}
+
+			if args[0].Type() != object.HASH_OBJ {
+				return NewError("builtin has_key first argument must be HASH, got %s", args[0].Type())
+			}
+
+			if !object.IsHashable(args[1]) {
+				return NewError("unusable as hash key: %s", args[1].Type())
+			}
+
+			_, okay := args[0].(*object.Hash).Get(args[1])
+			return BoolToBoolean(okay)
+		},
+	},
+	"delete": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return NewError("wrong number of arguments, got=%d, want=2", len(args))
+			}
+
+			if args[0].Type() != object.HASH_OBJ {
+				return NewError("builtin delete first argument must be HASH, got %s", args[0].Type())
+			}
+
+			if !object.IsHashable(args[1]) {
+				return NewError("unusable as hash key: %s", args[1].Type())
+			}
+
+			hash := args[0].(*object.Hash).Copy()
+			if err := hash.Delete(args[1]); err != nil {
+				return err
+			}
+
+			return hash
+		},
+	},
+	"merge": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) < 2 {
+				return NewError("wrong number of arguments, got=%d, want at least 2", len(args))
+			}
+
+			hash := object.NewHash()
+
+			for _, arg := range args {
+				other, okay := arg.(*object.Hash)
+				if !okay {
+					return NewError("builtin merge arguments must be HASH, got %s", arg.Type())
+				}
+
+				for _, pair := range other.Pairs {
+					if err := hash.Set(pair); err != nil {
+						return err
+					}
+				}
+			}
+
+			return hash
+		},
+	},
+	"freeze": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError("wrong number of arguments, got=%d, want=1", len(args))
+			}
+
+			Freeze(args[0])
+			return args[0]
+		},
+	},
+	"is_frozen": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError("wrong number of arguments, got=%d, want=1", len(args))
+			}
+
+			switch arg := args[0].(type) {
+			case *object.Array:
+				return BoolToBoolean(arg.Frozen)
+			case *object.Hash:
+				return BoolToBoolean(arg.Frozen)
+			default:
+				// every other value is immutable already
+				return TRUE
+			}
+		},
+	},
+	"gensym": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return NewError("wrong number of arguments, got=%d, want=0 or 1", len(args))
+			}
+
+			prefix := "g"
+			if len(args) == 1 {
+				str, okay := args[0].(*object.String)
+				if !okay {
+					return NewError("builtin gensym argument must be STRING, got %s", args[0].Type())
+				}
+				prefix = str.Value
+			}
+
+			// a quoted identifier, so that it can be unquoted into macro output
+			name := Gensym(prefix)
+			identifier := &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+			return &object.Quote{Node: identifier, Spliced: []ast.Node{identifier}}
+		},
+	},
+	"ast_type": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError("wrong number of arguments, got=%d, want=1", len(args))
+			}
+
+			quote, okay := args[0].(*object.Quote)
+			if !okay {
+				return NewError("builtin ast_type argument must be QUOTE, got %s", args[0].Type())
+			}
+
+			return &object.String{Value: NodeType(quote.Node)}
+		},
+	},
+	"ast_children": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError("wrong number of arguments, got=%d, want=1", len(args))
+			}
+
+			quote, okay := args[0].(*object.Quote)
+			if !okay {
+				return NewError("builtin ast_children argument must be QUOTE, got %s", args[0].Type())
+			}
+
+			children := []object.Object{}
+			for _, child := range ast.Children(quote.Node) {
+				children = append(children, SubQuote(quote, child))
+			}
+			return &object.Array{Elements: children}
+		},
+	},
+	"ast_name": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError("wrong number of arguments, got=%d, want=1", len(args))
+			}
+
+			quote, okay := args[0].(*object.Quote)
+			if !okay {
+				return NewError("builtin ast_name argument must be QUOTE, got %s", args[0].Type())
+			}
+
+			if name, okay := NodeName(quote.Node); okay {
+				return &object.String{Value: name}
+			}
+			return NULL
+		},
+	},
+	"make_ident": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return NewError("wrong number of arguments, got=%d, want=1", len(args))
+			}
+
+			str, okay := args[0].(*object.String)
+			if !okay {
+				return NewError("builtin make_ident argument must be STRING, got %s", args[0].Type())
+			}
+
+			identifier, err := MakeIdentifier(str.Value)
+			if err != nil {
+				return err
+			}
+			return &object.Quote{Node: identifier, Spliced: []ast.Node{identifier}}
+		},
+	},
+	"make_call": &object.Builtin{
+		Func: func(call object.CallFunction, args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return NewError("wrong number of arguments, got=%d, want=2", len(args))
+			}
+
+			array, okay := args[1].(*object.Array)
+			if !okay {
+				return NewError("builtin make_call second argument must be ARRAY, got %s", args[1].Type())
+			}
+
+			quote := &object.Quote{Spliced: []ast.Node{}}
+			ce := &ast.CallExpression{Token: token.Token{Type: token.LPAREN, Literal: "("}, Arguments: []ast.Expression{}}
+
+			switch function := args[0].(type) {
+			case *object.String:
+				identifier, err := MakeIdentifier(function.Value)
+				if err != nil {
+					return err
+				}
+				ce.Function = identifier
+				quote.Spliced = append(quote.Spliced, identifier)
+			case *object.Quote:
+				expression, okay := function.Node.(ast.Expression)
+				if !okay {
+					return NewError("builtin make_call function must be an expression, got %s", function.Node.String())
+				}
+				ce.Function = expression
+				quote.Spliced = append(quote.Spliced, function.Spliced...)
+			default:
+				return NewError("builtin make_call first argument must be STRING or QUOTE, got %s", args[0].Type())
+			}
+
+			for _, arg := range array.Elements {
+				expression, err := FromObjectToASTExpression(arg)
+				if err != nil {
+					return err
+				}
+				ce.Arguments = append(ce.Arguments, expression)
+				if q, okay := arg.(*object.Quote); okay {
+					quote.Spliced = append(quote.Spliced, q.Spliced...)
+				}
+			}
+
+			quote.Node = ce
+			return quote
+		},
+	},
+}
+
+// Freeze marks obj and every array and hash reachable from it as read-only.
+// Monkey has no indexed assignment and the collection builtins return new
+// values, so a frozen value can only be changed from Go, where Hash.Set and
+// Hash.Delete refuse it.
+func Freeze(obj object.Object) {
+	switch obj := obj.(type) {
+	case *object.Array:
+		if obj.Frozen {
+			return
+		}
+		obj.Frozen = true
+		for _, element := range obj.Elements {
+			Freeze(element)
+		}
+	case *object.Hash:
+		if obj.Frozen {
+			return
+		}
+		obj.Frozen = true
+		for _, pair := range obj.Pairs {
+			Freeze(pair.Key)
+			Freeze(pair.Value)
+		}
+	}
+}
+
+// BuiltinNames lists the names of all builtin functions, sorted
+func BuiltinNames() []string {
+	names := []string{}
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,133 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// BindPattern destructures value according to pattern and binds the
+// identifiers it contains into env. Unlike MatchPattern, a value with the
+// wrong shape is an error rather than a failed match.
+func BindPattern(pattern ast.Expression, value object.Object, env *object.Environment) *object.Error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			Bind(pattern, value, env)
+		}
+		return nil
+
+	case *ast.ArrayLiteral:
+		return BindArrayPattern(pattern, value, env)
+
+	case *ast.HashLiteral:
+		return BindHashPattern(pattern, value, env)
+
+	default:
+		return NewError("invalid binding pattern: %s", pattern.String())
+	}
+}
+
+func BindArrayPattern(pattern *ast.ArrayLiteral, value object.Object, env *object.Environment) *object.Error {
+	array, okay := value.(*object.Array)
+	if !okay {
+		return NewError("cannot destructure %s as ARRAY", value.Type())
+	}
+
+	elements := pattern.Elements
+	var rest *ast.SpreadExpression
+
+	if size := len(elements); size > 0 {
+		if spread, okay := elements[size - 1].(*ast.SpreadExpression); okay {
+			rest = spread
+			elements = elements[:size - 1]
+		}
+	}
+
+	if rest == nil && len(array.Elements) != len(elements) {
+		return NewError("wrong number of elements to destructure, got=%d, want=%d", len(array.Elements), len(elements))
+	}
+
+	if rest != nil && len(array.Elements) < len(elements) {
+		return NewError("wrong number of elements to destructure, got=%d, want at least %d", len(array.Elements), len(elements))
+	}
+
+	for i, element := range elements {
+		if err := BindPattern(element, array.Elements[i], env); err != nil {
+			return err
+		}
+	}
+
+	if rest != nil {
+		remaining := make([]object.Object, len(array.Elements) - len(elements))
+		copy(remaining, array.Elements[len(elements):])
+		return BindPattern(rest.Value, &object.Array{Elements: remaining}, env)
+	}
+
+	return nil
+}
+
+func BindHashPattern(pattern *ast.HashLiteral, value object.Object, env *object.Environment) *object.Error {
+	hash, okay := value.(*object.Hash)
+	if !okay {
+		return NewError("cannot destructure %s as HASH", value.Type())
+	}
+
+	for _, k := range pattern.Keys {
+		key := Eval(k, env)
+		if err, okay := key.(*object.Error); okay {
+			return err
+		}
+
+		if !object.IsHashable(key) {
+			return NewError("unusable as hash key: %s", key.Type())
+		}
+
+		pair, okay := hash.Get(key)
+		if !okay {
+			return NewError("missing key to destructure: %s", key.Inspect())
+		}
+
+		if err := BindPattern(pattern.Pairs[k], pair.Value, env); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PatternNames lists the names a binding pattern binds, in order
+func PatternNames(pattern ast.Expression) []string {
+	names := []string{}
+
+	for _, identifier := range PatternIdentifiers(pattern) {
+		names = append(names, identifier.Value)
+	}
+
+	return names
+}
+
+// PatternIdentifiers lists the identifiers a binding pattern binds, in order
+func PatternIdentifiers(pattern ast.Expression) []*ast.Identifier {
+	identifiers := []*ast.Identifier{}
+
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			identifiers = append(identifiers, pattern)
+		}
+	case *ast.SpreadExpression:
+		identifiers = append(identifiers, PatternIdentifiers(pattern.Value)...)
+	case *ast.DefaultParameter:
+		identifiers = append(identifiers, PatternIdentifiers(pattern.Pattern)...)
+	case *ast.ArrayLiteral:
+		for _, element := range pattern.Elements {
+			identifiers = append(identifiers, PatternIdentifiers(element)...)
+		}
+	case *ast.HashLiteral:
+		for _, key := range pattern.Keys {
+			identifiers = append(identifiers, PatternIdentifiers(pattern.Pairs[key])...)
+		}
+	}
+
+	return identifiers
+}
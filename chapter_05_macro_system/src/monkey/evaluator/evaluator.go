@@ -2,6 +2,8 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
+	"math/big"
 	"monkey/ast"
 	"monkey/object"
 )
@@ -38,10 +40,22 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if IsError(OperandLeft) {
 			return OperandLeft
 		}
+		if node.Operator == "??" {
+			if OperandLeft != NULL {
+				return OperandLeft
+			}
+			return Eval(node.OperandRight, env)
+		}
+		if node.Operator == "|>" && node.Function == nil {
+			return EvalPipeline(node.OperandRight, OperandLeft, env)
+		}
 		OperandRight := Eval(node.OperandRight, env)
 		if IsError(OperandRight) {
 			return OperandRight
 		}
+		if node.Function != nil {
+			return EvalDeclaredOperator(node, OperandLeft, OperandRight, env)
+		}
 		return EvalInfixExpression(node.Operator, OperandLeft, OperandRight)
 	case *ast.BlockStatement:
 		return EvalBlockStatement(node, env)
@@ -50,48 +64,54 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if IsError(value) {
 			return value
 		}
-		env.Set(node.Name.Value, value)
+		return EvalLetStatement(node, value, env)
 	case *ast.ReturnStatement:
 		value := Eval(node.Value, env)
 		if IsError(value) {
 			return value
 		}
 		return &object.ReturnValue{Value: value}
+	case *ast.InfixDeclaration:
+		function := Eval(node.Function, env)
+		if IsError(function) {
+			return function
+		}
+		Bind(node.Name, function, env)
+		return nil
 
 	// expressions
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return object.NewBigInteger(new(big.Int).Set(node.Big))
+		}
 		return &object.Integer{Value: node.Value}
 	case *ast.Boolean:
 		return BoolToBoolean(node.Value)
+	case *ast.NullLiteral:
+		return NULL
 	case *ast.IfExpression:
 		return EvalIfElseExpression(node, env)
+	case *ast.ConditionalExpression:
+		return EvalConditionalExpression(node, env)
+	case *ast.MatchExpression:
+		return EvalMatchExpression(node, env)
+	case *ast.SpreadExpression:
+		return NewError("spread operator not supported here: %s", node.String())
 
 	case *ast.Identifier:
 		return EvalIdentifier(node, env)
 		
 	case *ast.FunctionLiteral:
 		return &object.Function{
+			Name: node.Name,
 			Parameters: node.Parameters,
 			Env: env,
 			Body: node.Body}
 
 	case *ast.CallExpression:
-		if node.Function.TokenLiteral() == "quote" {
-			return quote(node.Arguments[0], env)
-		}
-
-		function := Eval(node.Function, env)
-		if IsError(function) {
-			return function
-		}
-
-		args := EvalExpressions(node.Arguments, env)
-		if len(args) == 1 && IsError(args[0]) {
-			return args[0]
-		}
+		value, _ := EvalChain(node, env)
+		return value
 
-		return CallFunction(function, args)
-	
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
@@ -105,17 +125,8 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return &object.Array{Elements: elements}
 
 	case *ast.IndexExpression:
-		array := Eval(node.Array, env)
-		if IsError(array) {
-			return array
-		}
-		
-		index := Eval(node.Index, env)
-		if IsError(index) {
-			return index
-		}
-
-		return EvalIndexExpression(array, index)
+		value, _ := EvalChain(node, env)
+		return value
 
 	case *ast.HashLiteral:
 		return EvalHashLiteral(node, env)
@@ -124,6 +135,46 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	return nil
 }
 
+func EvalLetStatement(let *ast.LetStatement, value object.Object, env *object.Environment) object.Object {
+	names := []string{}
+	if let.Pattern != nil {
+		names = PatternNames(let.Pattern)
+	} else {
+		names = append(names, let.Name.Value)
+	}
+
+	for _, name := range names {
+		if env.IsConstant(name) {
+			return NewError("cannot reassign constant %s", name)
+		}
+	}
+
+	if let.Pattern != nil {
+		if err := BindPattern(let.Pattern, value, env); err != nil {
+			return err
+		}
+	} else {
+		Bind(let.Name, value, env)
+	}
+
+	if let.Constant {
+		for _, name := range names {
+			env.MarkConstant(name)
+		}
+	}
+
+	return nil
+}
+
+// Bind sets identifier in env, using the slot assigned by the resolver if any
+func Bind(identifier *ast.Identifier, value object.Object, env *object.Environment) {
+	if identifier.Resolved {
+		env.SetSlot(identifier.Slot, identifier.Value, value)
+	} else {
+		env.Set(identifier.Value, value)
+	}
+}
+
 func EvalProgram(program *ast.Program, env *object.Environment) object.Object {
 	var result object.Object
 
@@ -155,6 +206,8 @@ func EvalPrefixExpression(operator string, operand object.Object) object.Object
 		return EvalBangOperatorExpression(operand)
 	case "-":
 		return EvalMinusOperatorExpression(operand)
+	case "~":
+		return EvalTildeOperatorExpression(operand)
 	default:
 		return NewError("unknown operator: %s%s", operator, operand.Type())
 	}
@@ -178,20 +231,39 @@ func EvalMinusOperatorExpression(operand object.Object) object.Object {
 		return NewError("unknown operator: -%s", operand.Type())
 	}
 
-	value := operand.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	integer := operand.(*object.Integer)
+	if integer.IsBig() || integer.Value == math.MinInt64 {
+		return object.NewBigInteger(integer.BigInt().Neg(integer.BigInt()))
+	}
+
+	return &object.Integer{Value: -integer.Value}
+}
+
+func EvalTildeOperatorExpression(operand object.Object) object.Object {
+	if operand.Type() != object.INTEGER_OBJ {
+		return NewError("unknown operator: ~%s", operand.Type())
+	}
+
+	integer := operand.(*object.Integer)
+	if integer.IsBig() {
+		return object.NewBigInteger(integer.BigInt().Not(integer.BigInt()))
+	}
+
+	return &object.Integer{Value: ^integer.Value}
 }
 
 func EvalInfixExpression(operator string, OperandLeft object.Object, OperandRight object.Object) object.Object {
 	switch {
+	case operator == ">>>":
+		return Compose(OperandLeft, OperandRight)
 	case OperandLeft.Type() == object.INTEGER_OBJ && OperandRight.Type() == object.INTEGER_OBJ:
 		return EvalIntegerInfixExpression(operator, OperandLeft, OperandRight)
-	case OperandLeft.Type() == object.STRING_OBJ && OperandRight.Type() == object.STRING_OBJ:
-		return EvalStringInfixExpression(operator, OperandLeft, OperandRight)
 	case operator == "==":
-		return BoolToBoolean(OperandLeft == OperandRight)
+		return BoolToBoolean(object.Equal(OperandLeft, OperandRight))
 	case operator == "!=":
-		return BoolToBoolean(OperandLeft != OperandRight)
+		return BoolToBoolean(!object.Equal(OperandLeft, OperandRight))
+	case OperandLeft.Type() == object.STRING_OBJ && OperandRight.Type() == object.STRING_OBJ:
+		return EvalStringInfixExpression(operator, OperandLeft, OperandRight)
 	case OperandLeft.Type() != OperandRight.Type():
 		return NewError("type mismatch: %s %s %s", OperandLeft.Type(), operator, OperandRight.Type())
 	default:
@@ -199,19 +271,125 @@ func EvalInfixExpression(operator string, OperandLeft object.Object, OperandRigh
 	}
 }
 
+// EvalPipeline passes value as the first argument of the call stage is,
+// or as the only argument of the function it evaluates to otherwise
+func EvalPipeline(stage ast.Expression, value object.Object, env *object.Environment) object.Object {
+	call, okay := stage.(*ast.CallExpression)
+	if !okay {
+		function := Eval(stage, env)
+		if IsError(function) {
+			return function
+		}
+		return CallFunction(function, []object.Object{value})
+	}
+
+	function := Eval(call.Function, env)
+	if IsError(function) {
+		return function
+	}
+
+	args := EvalExpressions(call.Arguments, env)
+	if len(args) == 1 && IsError(args[0]) {
+		return args[0]
+	}
+
+	return CallFunction(function, append([]object.Object{value}, args...))
+}
+
+// Compose returns the function calling first with its arguments, then
+// second with the result
+func Compose(first object.Object, second object.Object) object.Object {
+	if !IsCallable(first) || !IsCallable(second) {
+		return NewError("cannot compose %s >>> %s, both must be functions", first.Type(), second.Type())
+	}
+
+	return &object.Builtin{Func: func(call object.CallFunction, args ...object.Object) object.Object {
+		result := call(first, args)
+		if IsError(result) {
+			return result
+		}
+		return call(second, []object.Object{result})
+	}}
+}
+
+func IsCallable(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Function, *object.Builtin:
+		return true
+	}
+	return false
+}
+
+// EvalDeclaredOperator calls the function bound by the infix statement
+// that declared the operator of ie
+func EvalDeclaredOperator(ie *ast.InfixExpression, OperandLeft object.Object, OperandRight object.Object, env *object.Environment) object.Object {
+	function := EvalIdentifier(ie.Function, env)
+	if IsError(function) {
+		return NewError("operator %s is not defined here", ie.Operator)
+	}
+	return CallFunction(function, []object.Object{OperandLeft, OperandRight})
+}
+
 func EvalIntegerInfixExpression(operator string, OperandLeft object.Object, OperandRight object.Object) object.Object {
-	ValueLeft  := OperandLeft.(*object.Integer).Value
-	ValueRight := OperandRight.(*object.Integer).Value
+	IntegerLeft  := OperandLeft.(*object.Integer)
+	IntegerRight := OperandRight.(*object.Integer)
+
+	if IntegerLeft.IsBig() || IntegerRight.IsBig() {
+		return EvalBigIntegerInfixExpression(operator, IntegerLeft, IntegerRight)
+	}
+
+	ValueLeft  := IntegerLeft.Value
+	ValueRight := IntegerRight.Value
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: ValueLeft + ValueRight}
+		result := ValueLeft + ValueRight
+		if (ValueLeft > 0 && ValueRight > 0 && result < 0) || (ValueLeft < 0 && ValueRight < 0 && result >= 0) {
+			return EvalBigIntegerInfixExpression(operator, IntegerLeft, IntegerRight)
+		}
+		return &object.Integer{Value: result}
 	case "-":
-		return &object.Integer{Value: ValueLeft - ValueRight}
+		result := ValueLeft - ValueRight
+		if (ValueLeft >= 0 && ValueRight < 0 && result < 0) || (ValueLeft < 0 && ValueRight > 0 && result >= 0) {
+			return EvalBigIntegerInfixExpression(operator, IntegerLeft, IntegerRight)
+		}
+		return &object.Integer{Value: result}
 	case "*":
-		return &object.Integer{Value: ValueLeft * ValueRight}
+		result := ValueLeft * ValueRight
+		if ValueLeft != 0 && (result / ValueLeft != ValueRight || (ValueLeft == -1 && ValueRight == math.MinInt64)) {
+			return EvalBigIntegerInfixExpression(operator, IntegerLeft, IntegerRight)
+		}
+		return &object.Integer{Value: result}
 	case "/":
+		if ValueRight == 0 {
+			return NewError("division by zero")
+		}
+		if ValueLeft == math.MinInt64 && ValueRight == -1 {
+			return EvalBigIntegerInfixExpression(operator, IntegerLeft, IntegerRight)
+		}
 		return &object.Integer{Value: ValueLeft / ValueRight}
+	case "&":
+		return &object.Integer{Value: ValueLeft & ValueRight}
+	case "|":
+		return &object.Integer{Value: ValueLeft | ValueRight}
+	case "^":
+		return &object.Integer{Value: ValueLeft ^ ValueRight}
+	case "<<":
+		if ValueRight < 0 {
+			return NewError("negative shift count: %d", ValueRight)
+		}
+		if ValueRight >= 63 || (ValueLeft << ValueRight) >> ValueRight != ValueLeft {
+			return EvalBigIntegerInfixExpression(operator, IntegerLeft, IntegerRight)
+		}
+		return &object.Integer{Value: ValueLeft << ValueRight}
+	case ">>":
+		if ValueRight < 0 {
+			return NewError("negative shift count: %d", ValueRight)
+		}
+		if ValueRight >= 64 {
+			ValueRight = 63
+		}
+		return &object.Integer{Value: ValueLeft >> ValueRight}
 	case "<":
 		return BoolToBoolean(ValueLeft < ValueRight)
 	case ">":
@@ -225,6 +403,61 @@ func EvalIntegerInfixExpression(operator string, OperandLeft object.Object, Oper
 	}
 }
 
+// MaxShiftCount bounds left shifts so that a typo cannot allocate gigabytes
+const MaxShiftCount = 1 << 20
+
+// EvalBigIntegerInfixExpression handles operands or results that do not fit in an int64
+func EvalBigIntegerInfixExpression(operator string, IntegerLeft *object.Integer, IntegerRight *object.Integer) object.Object {
+	ValueLeft  := IntegerLeft.BigInt()
+	ValueRight := IntegerRight.BigInt()
+
+	switch operator {
+	case "+":
+		return object.NewBigInteger(ValueLeft.Add(ValueLeft, ValueRight))
+	case "-":
+		return object.NewBigInteger(ValueLeft.Sub(ValueLeft, ValueRight))
+	case "*":
+		return object.NewBigInteger(ValueLeft.Mul(ValueLeft, ValueRight))
+	case "/":
+		if ValueRight.Sign() == 0 {
+			return NewError("division by zero")
+		}
+		return object.NewBigInteger(ValueLeft.Quo(ValueLeft, ValueRight))
+	case "&":
+		return object.NewBigInteger(ValueLeft.And(ValueLeft, ValueRight))
+	case "|":
+		return object.NewBigInteger(ValueLeft.Or(ValueLeft, ValueRight))
+	case "^":
+		return object.NewBigInteger(ValueLeft.Xor(ValueLeft, ValueRight))
+	case "<<", ">>":
+		if ValueRight.Sign() < 0 {
+			return NewError("negative shift count: %s", ValueRight.String())
+		}
+		if operator == ">>" {
+			// past the length of the left operand only the sign is left, 0 or -1
+			count := uint(ValueLeft.BitLen())
+			if ValueRight.IsUint64() && ValueRight.Uint64() < uint64(count) {
+				count = uint(ValueRight.Uint64())
+			}
+			return object.NewBigInteger(ValueLeft.Rsh(ValueLeft, count))
+		}
+		if !ValueRight.IsUint64() || ValueRight.Uint64() > MaxShiftCount {
+			return NewError("shift count too large: %s", ValueRight.String())
+		}
+		return object.NewBigInteger(ValueLeft.Lsh(ValueLeft, uint(ValueRight.Uint64())))
+	case "<":
+		return BoolToBoolean(ValueLeft.Cmp(ValueRight) < 0)
+	case ">":
+		return BoolToBoolean(ValueLeft.Cmp(ValueRight) > 0)
+	case "==":
+		return BoolToBoolean(ValueLeft.Cmp(ValueRight) == 0)
+	case "!=":
+		return BoolToBoolean(ValueLeft.Cmp(ValueRight) != 0)
+	default:
+		return NewError("unknown operator: %s %s %s", IntegerLeft.Type(), operator, IntegerRight.Type())
+	}
+}
+
 func EvalStringInfixExpression(operator string, OperandLeft object.Object, OperandRight object.Object) object.Object {
 	ValueLeft  := OperandLeft.(*object.String).Value
 	ValueRight := OperandRight.(*object.String).Value
@@ -289,7 +522,12 @@ func NewError(format string, a ... interface{}) *object.Error {
 }
 
 func EvalIdentifier(i *ast.Identifier, env *object.Environment) object.Object {
-	
+	if i.Resolved {
+		if value, okay := env.GetSlot(i.Depth, i.Slot, i.Value); okay {
+			return value
+		}
+	}
+
 	if value, okay := env.Get(i.Value); okay {
 		return value
 	}
@@ -298,13 +536,70 @@ func EvalIdentifier(i *ast.Identifier, env *object.Environment) object.Object {
 		return builtin
 	}
 
-	return NewError("identifier not found: " + i.Value)
+	return NewError("identifier not found: %s", i.Value)
+}
+
+// EvalChain evaluates a chain of indexes and calls. Once an optional index
+// meets null the rest of the chain is skipped, as a?["b"]["c"] and
+// a?["f"](1) are null when a is, and the result reports the skip.
+func EvalChain(node ast.Expression, env *object.Environment) (object.Object, bool) {
+	switch node := node.(type) {
+	case *ast.IndexExpression:
+		array, skipped := EvalChain(node.Array, env)
+		if skipped || IsError(array) {
+			return array, skipped
+		}
+		if node.Optional && array == NULL {
+			return NULL, true
+		}
+
+		index := Eval(node.Index, env)
+		if IsError(index) {
+			return index, false
+		}
+
+		return EvalIndexExpression(array, index), false
+
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			return quote(node.Arguments[0], env), false
+		}
+
+		function, skipped := EvalChain(node.Function, env)
+		if skipped || IsError(function) {
+			return function, skipped
+		}
+
+		args := EvalExpressions(node.Arguments, env)
+		if len(args) == 1 && IsError(args[0]) {
+			return args[0], false
+		}
+
+		return CallFunction(function, args), false
+	}
+
+	return Eval(node, env), false
 }
 
 func EvalExpressions(expressions []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
 	for _, expression := range expressions {
+		if spread, okay := expression.(*ast.SpreadExpression); okay {
+			evaluated := Eval(spread.Value, env)
+			if IsError(evaluated) {
+				return []object.Object{evaluated}
+			}
+
+			array, okay := evaluated.(*object.Array)
+			if !okay {
+				return []object.Object{NewError("spread operator requires ARRAY, got %s", evaluated.Type())}
+			}
+
+			result = append(result, array.Elements...)
+			continue
+		}
+
 		evaluated := Eval(expression, env)
 		if IsError(evaluated) {
 			return []object.Object{evaluated}
@@ -318,24 +613,96 @@ func EvalExpressions(expressions []ast.Expression, env *object.Environment) []ob
 func CallFunction(fn object.Object, args []object.Object) object.Object {
 	switch function := fn.(type) {
 	case *object.Function:
-		ExtendedEnv := ExtendFunctionEnv(function, args)
+		ExtendedEnv, err := ExtendFunctionEnv(function, args)
+		if err != nil {
+			return err
+		}
 		evaluated := Eval(function.Body, ExtendedEnv)
 		return UnwrapReturnValue(evaluated)
 	case *object.Builtin:
-		return function.Func(args...)
+		return function.Func(CallFunction, args...)
 	default:
 		return NewError("not a function: %s", fn.Type())
 	}
 }
 
-func ExtendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+func ExtendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, *object.Error) {
+	if err := CheckArity(fn, len(args)); err != nil {
+		return nil, err
+	}
+
 	env := object.NewEnclosedEnvironment(fn.Env)
 
 	for i, param := range fn.Parameters {
-		env.Set(param.Value, args[i])
+		switch param := param.(type) {
+		case *ast.SpreadExpression:
+			rest := []object.Object{}
+			if i < len(args) {
+				rest = append(rest, args[i:]...)
+			}
+			if err := BindPattern(param.Value, &object.Array{Elements: rest}, env); err != nil {
+				return nil, err
+			}
+
+		case *ast.DefaultParameter:
+			var value object.Object
+			if i < len(args) {
+				value = args[i]
+			} else {
+				// defaults are evaluated at call time and can use earlier parameters
+				value = Eval(param.Default, env)
+				if err, okay := value.(*object.Error); okay {
+					return nil, err
+				}
+			}
+			if err := BindPattern(param.Pattern, value, env); err != nil {
+				return nil, err
+			}
+
+		default:
+			if err := BindPattern(param, args[i], env); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return env, nil
+}
+
+func CheckArity(fn *object.Function, given int) *object.Error {
+	required, optional, variadic := 0, 0, false
+
+	for _, param := range fn.Parameters {
+		switch param.(type) {
+		case *ast.SpreadExpression:
+			variadic = true
+		case *ast.DefaultParameter:
+			optional += 1
+		default:
+			required += 1
+		}
 	}
 
-	return env
+	if given >= required && (variadic || given <= required + optional) {
+		return nil
+	}
+
+	name := fn.Name
+	if name == "" {
+		name = "anonymous function"
+	}
+
+	var want string
+	switch {
+	case variadic:
+		want = fmt.Sprintf("at least %d", required)
+	case optional > 0:
+		want = fmt.Sprintf("%d to %d", required, required + optional)
+	default:
+		want = fmt.Sprintf("%d", required)
+	}
+
+	return NewError("wrong number of arguments to %s, got=%d, want=%s", name, given, want)
 }
 
 func UnwrapReturnValue(obj object.Object) object.Object {
@@ -358,10 +725,11 @@ func EvalIndexExpression(container, index object.Object) object.Object {
 
 func EvalArrayIndexExpression(container, index object.Object) object.Object {
 	array := container.(*object.Array)
-	i := index.(*object.Integer).Value
+	integer := index.(*object.Integer)
+	i := integer.Value
 	size := int64(len(array.Elements))
 
-	if i < 0 || i >= size {
+	if integer.IsBig() || i < 0 || i >= size {
 		return NULL
 	}
 
@@ -371,12 +739,11 @@ func EvalArrayIndexExpression(container, index object.Object) object.Object {
 func EvalHashIndexExpression(container, index object.Object) object.Object {
 	hash := container.(*object.Hash)
 
-	key, okay := index.(object.Hashable)
-	if !okay {
+	if !object.IsHashable(index) {
 		return NewError("unusable as hash key: %s", index.Type())
 	}
 
-	pair, okay := hash.Pairs[key.HashKey()]
+	pair, okay := hash.Get(index)
 	if !okay {
 		return NULL
 	}
@@ -385,16 +752,17 @@ func EvalHashIndexExpression(container, index object.Object) object.Object {
 }
 
 func EvalHashLiteral(hash *ast.HashLiteral, env *object.Environment) object.Object {
-	pairs := make(map[object.HashKey]object.HashPair)
+	result := object.NewHash()
+
+	for _, k := range hash.Keys {
+		v := hash.Pairs[k]
 
-	for k, v := range hash.Pairs {
 		key := Eval(k, env)
 		if IsError(key) {
 			return key
 		}
 
-		hashable, okay := key.(object.Hashable)
-		if !okay {
+		if !object.IsHashable(key) {
 			return NewError("unusable as hash key: %s", key.Type())
 		}
 
@@ -403,8 +771,8 @@ func EvalHashLiteral(hash *ast.HashLiteral, env *object.Environment) object.Obje
 			return val
 		}
 
-		pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: val}
+		result.Set(object.HashPair{Key: key, Value: val})
 	}
 
-	return &object.Hash{Pairs: pairs}
+	return result
 }
\ No newline at end of file
@@ -4,6 +4,7 @@ import (
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/resolver"
 	"testing"
 )
 
@@ -76,6 +77,27 @@ func CheckEval(input string) object.Object {
 	return Eval(program, env)
 }
 
+// EvalTest pairs an input with the Inspect output of its result
+type EvalTest struct {
+	input string
+	expected string
+}
+
+func CheckEvalTests(t *testing.T, tests []EvalTest) {
+	for _, tt := range tests {
+		evaluated := CheckEval(tt.input)
+
+		if evaluated == nil {
+			t.Errorf("eval returned nil for %q", tt.input)
+			continue
+		}
+
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q, got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
 func CheckIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	result, okay := obj.(*object.Integer)
 
@@ -441,25 +463,29 @@ func TestHashLiteral(t *testing.T) {
 		t.Fatalf("eval didn't return hash, got=%T (%+v)", evaluated, evaluated)
 	}
 
-	expected := map[object.HashKey] int64 {
-		(&object.String{Value: "one"}).HashKey():   1,
-		(&object.String{Value: "two"}).HashKey():   2,
-		(&object.String{Value: "three"}).HashKey(): 3,
-		(&object.Integer{Value: 4}).HashKey():      4,
-		TRUE.HashKey():                             5,
-		FALSE.HashKey():                            6,
+	expected := []struct {
+		key object.Object
+		value int64
+	}{
+		{ &object.String{Value: "one"},   1 },
+		{ &object.String{Value: "two"},   2 },
+		{ &object.String{Value: "three"}, 3 },
+		{ &object.Integer{Value: 4},      4 },
+		{ TRUE,                           5 },
+		{ FALSE,                          6 },
 	}
 
 	if len(hash.Pairs) != len(expected) {
 		t.Fatalf("hash has wrong number of pairs, got=%d", len(hash.Pairs))
 	}
 
-	for key, val := range expected {
-		pair, okay := hash.Pairs[key]
+	for _, tt := range expected {
+		pair, okay := hash.Get(tt.key)
 		if !okay {
-			t.Errorf("no pair for key in pairs")
+			t.Errorf("no pair for key %s in pairs", tt.key.Inspect())
+			continue
 		}
-		CheckIntegerObject(t, pair.Value, val)
+		CheckIntegerObject(t, pair.Value, tt.value)
 	}
 }
 
@@ -486,4 +512,464 @@ func TestHashIndexExpression(t *testing.T) {
 			CheckNullObject(t, evaluated)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestHigherOrderBuiltinFunction(t *testing.T) {
+	tests := []EvalTest{
+		{ `map([1, 2, 3], fn(x) { x * 2 })`, "[2, 4, 6]" },
+		{ `map([], fn(x) { x * 2 })`, "[]" },
+		{ `filter([1, 2, 3, 4], fn(x) { x > 2 })`, "[3, 4]" },
+		{ `reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, "10" },
+		{ `reduce([], 7, fn(acc, x) { acc + x })`, "7" },
+		{ `sort([3, 1, 2])`, "[1, 2, 3]" },
+		{ `sort(["b", "c", "a"])`, "[a, b, c]" },
+		{ `sort([3, 1, 2], fn(a, b) { a > b })`, "[3, 2, 1]" },
+		{ `sort([3, 1, 2], fn(a, b) { b - a })`, "[3, 2, 1]" },
+		{ `let a = [3, 1, 2]; sort(a); a`, "[3, 1, 2]" },
+		{ `reverse([1, 2, 3])`, "[3, 2, 1]" },
+		{ `range(3)`, "[0, 1, 2]" },
+		{ `range(2, 5)`, "[2, 3, 4]" },
+		{ `range(5, 0, -2)`, "[5, 3, 1]" },
+		{ `zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]" },
+		{ `any([1, 2, 3], fn(x) { x > 2 })`, "true" },
+		{ `any([], fn(x) { true })`, "false" },
+		{ `all([1, 2, 3], fn(x) { x > 0 })`, "true" },
+		{ `all([1, 2, 3], fn(x) { x > 1 })`, "false" },
+		{ `find([1, 2, 3], fn(x) { x > 1 })`, "2" },
+		{ `find([1, 2, 3], fn(x) { x > 3 })`, "null" },
+		{ `flat_map([1, 2], fn(x) { [x, x * 10] })`, "[1, 10, 2, 20]" },
+		{ `map([[1], [2, 3]], len)`, "[1, 2]" },
+		{ `map([1, 2], fn(x) { x + true })`, "ERROR: type mismatch: INTEGER + BOOLEAN" },
+		{ `map(1, fn(x) { x })`, "ERROR: builtin map first argument must be ARRAY, got INTEGER" },
+		{ `sort([1, 2], fn(a, b) { "x" })`, "ERROR: builtin sort comparator must return BOOLEAN or INTEGER, got STRING" },
+		{ `range(1, 5, 0)`, "ERROR: builtin range step must not be zero" },
+		{ `flat_map([1], fn(x) { x })`, "ERROR: builtin flat_map function must return ARRAY, got INTEGER" },
+	}
+
+	CheckEvalTests(t, tests)
+}
+
+func TestHashBuiltinFunction(t *testing.T) {
+	tests := []EvalTest{
+		{ `len({})`, "0" },
+		{ `len({"a": 1, "b": 2})`, "2" },
+		{ `keys({"b": 1, "a": 2, "c": 3})`, "[b, a, c]" },
+		{ `values({"b": 1, "a": 2, "c": 3})`, "[1, 2, 3]" },
+		{ `items({"b": 1, 2: true})`, "[[b, 1], [2, true]]" },
+		{ `has_key({"a": 1}, "a")`, "true" },
+		{ `has_key({"a": 1}, "b")`, "false" },
+		{ `has_key({"a": 1}, [1])`, "false" },
+		{ `has_key({"a": 1}, fn(x) { x })`, "ERROR: unusable as hash key: FUNCTION" },
+		{ `keys(delete({"a": 1, "b": 2, "c": 3}, "b"))`, "[a, c]" },
+		{ `let h = {"a": 1, "b": 2}; delete(h, "a"); keys(h)`, "[a, b]" },
+		{ `keys(delete({"a": 1}, "z"))`, "[a]" },
+		{ `let m = merge({"a": 1, "b": 2}, {"b": 20, "c": 30}); [keys(m), values(m)]`, "[[a, b, c], [1, 20, 30]]" },
+		{ `merge({}, 1)`, "ERROR: builtin merge arguments must be HASH, got INTEGER" },
+		{ `keys([1])`, "ERROR: builtin keys argument must be HASH, got ARRAY" },
+	}
+
+	CheckEvalTests(t, tests)
+}
+
+func TestHashInspectOrder(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{ `{"z": 1, "y": 2, "x": 3, 10: 4, true: 5}`, "{z: 1, y: 2, x: 3, 10: 4, true: 5}" },
+		{ `{"a": 1, "a": 2, "b": 3}`, "{a: 2, b: 3}" },
+		{ `merge({"z": 1, "a": 2}, {"m": 3, "z": 4})`, "{z: 4, a: 2, m: 3}" },
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 10; i++ {
+			evaluated := CheckEval(tt.input)
+
+			if evaluated.Inspect() != tt.expected {
+				t.Fatalf("wrong order for %q, got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+			}
+		}
+	}
+}
+
+func TestStructuralEquality(t *testing.T) {
+	tests := []struct {
+		input string
+		expected bool
+	}{
+		{ `"monkey" == "monkey"`, true },
+		{ `"monkey" == "banana"`, false },
+		{ `"monkey" != "banana"`, true },
+		{ `[1, 2] == [1, 2]`, true },
+		{ `[1, 2] == [2, 1]`, false },
+		{ `[1, [2, "three"]] == [1, [2, "three"]]`, true },
+		{ `[1, 2] == [1, 2, 3]`, false },
+		{ `[] != []`, false },
+		{ `{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, true },
+		{ `{"a": 1} == {"a": 2}`, false },
+		{ `{"a": 1} == {"b": 1}`, false },
+		{ `{} == {}`, true },
+		{ `if (false) { 1 } == if (false) { 2 }`, true },
+		{ `let f = fn(x) { x }; f == f`, true },
+		{ `fn(x) { x } == fn(x) { x }`, false },
+		{ `len == len`, true },
+		{ `1 == "1"`, false },
+		{ `1 != "1"`, true },
+		{ `[1] == {1: 1}`, false },
+		{ `true == "true"`, false },
+		{ `"a" == if (false) { 1 }`, false },
+	}
+
+	for _, tt := range tests {
+		evaluated := CheckEval(tt.input)
+		if !CheckBooleanObject(t, evaluated, tt.expected) {
+			t.Errorf("input was %q", tt.input)
+		}
+	}
+}
+
+func TestCompositeHashKey(t *testing.T) {
+	tests := []EvalTest{
+		{ `{[1, 2]: "a"}[[1, 2]]`, "a" },
+		{ `{[1, 2]: "a"}[[2, 1]]`, "null" },
+		{ `let p = [0, 0]; {[0, 0]: 1, [0, 1]: 2}[p]`, "1" },
+		{ `{[1, [2, 3]]: true}[[1, [2, 3]]]`, "true" },
+		{ `{{"a": 1, "b": 2}: "h"}[{"b": 2, "a": 1}]`, "h" },
+		{ `len({[1]: 1, [1]: 2})`, "1" },
+		{ `has_key({[1, "x"]: 1}, [1, "x"])`, "true" },
+		{ `{[fn(x) { x }]: 1}`, "ERROR: unusable as hash key: ARRAY" },
+		{ `{1: 1}[[len]]`, "ERROR: unusable as hash key: ARRAY" },
+	}
+
+	CheckEvalTests(t, tests)
+}
+
+func TestBigIntegerArithmetic(t *testing.T) {
+	tests := []EvalTest{
+		{ `9223372036854775807 + 1`, "9223372036854775808" },
+		{ `-9223372036854775807 - 1 - 1`, "-9223372036854775809" },
+		{ `4294967296 * 4294967296`, "18446744073709551616" },
+		{ `(9223372036854775807 + 1) - 1`, "9223372036854775807" },
+		{ `-(-9223372036854775807 - 1)`, "9223372036854775808" },
+		{ `(-9223372036854775807 - 1) / -1`, "9223372036854775808" },
+		{ `18446744073709551616 / 4294967296`, "4294967296" },
+		{ `-18446744073709551617 / 2`, "-9223372036854775808" },
+		{ `123456789012345678901234567890`, "123456789012345678901234567890" },
+		{ `let factorial = fn(n) { if (n < 2) { 1 } else { n * factorial(n - 1) } }; factorial(25)`, "15511210043330985984000000" },
+		{ `18446744073709551616 > 9223372036854775807`, "true" },
+		{ `18446744073709551616 == 4294967296 * 4294967296`, "true" },
+		{ `{18446744073709551616: "big"}[4294967296 * 4294967296]`, "big" },
+		{ `[1, 2][18446744073709551616]`, "null" },
+		{ `1 / 0`, "ERROR: division by zero" },
+		{ `18446744073709551616 / 0`, "ERROR: division by zero" },
+	}
+
+	CheckEvalTests(t, tests)
+}
+
+func TestIntegerLiteralFormats(t *testing.T) {
+	tests := []EvalTest{
+		{ `0xFF`, "255" },
+		{ `0Xff`, "255" },
+		{ `0b1010`, "10" },
+		{ `0o17`, "15" },
+		{ `1_000_000`, "1000000" },
+		{ `0xFFFF_FFFF`, "4294967295" },
+		{ `0xFFFFFFFFFFFFFFFF`, "18446744073709551615" },
+		{ `0b1100 & 0b1010`, "8" },
+		{ `0b1100 | 0b1010`, "14" },
+		{ `0b1100 ^ 0b1010`, "6" },
+		{ `~0`, "-1" },
+		{ `~5`, "-6" },
+		{ `1 << 4`, "16" },
+		{ `256 >> 4`, "16" },
+		{ `-16 >> 2`, "-4" },
+		{ `1 >> 100`, "0" },
+		{ `-1 >> 100`, "-1" },
+		{ `1 << 64`, "18446744073709551616" },
+		{ `3 << 62`, "13835058055282163712" },
+		{ `(1 << 64) >> 60`, "16" },
+		{ `(1 << 64) | 1`, "18446744073709551617" },
+		{ `~(1 << 64)`, "-18446744073709551617" },
+		{ `1 + 2 << 3`, "24" },
+		{ `6 & 3 == 2`, "true" },
+		{ `1 | 2 ^ 3 & 4`, "3" },
+		{ `1 >> 2000000`, "0" },
+		{ `(1 << 64) >> 2000000`, "0" },
+		{ `-(1 << 64) >> 2000000`, "-1" },
+		{ `(1 << 64) >> (1 << 64)`, "0" },
+		{ `1 << -1`, "ERROR: negative shift count: -1" },
+		{ `1 << 2000000`, "ERROR: shift count too large: 2000000" },
+		{ `(1 << 64) << 2000000`, "ERROR: shift count too large: 2000000" },
+		{ `~true`, "ERROR: unknown operator: ~BOOLEAN" },
+	}
+
+	CheckEvalTests(t, tests)
+}
+
+func TestNullOperators(t *testing.T) {
+	tests := []EvalTest{
+		{ `null`, "null" },
+		{ `null == null`, "true" },
+		{ `null == false`, "false" },
+		{ `{"a": 1}["b"] == null`, "true" },
+		{ `!null`, "true" },
+		{ `null ?? 5`, "5" },
+		{ `3 ?? 5`, "3" },
+		{ `false ?? 5`, "false" },
+		{ `{"a": 1}["b"] ?? "default"`, "default" },
+		{ `1 ?? undefined_name`, "1" },
+		{ `null ?? undefined_name`, "ERROR: identifier not found: undefined_name" },
+		{ `let config = {"db": {"host": "localhost"}}; config?["db"]?["host"]`, "localhost" },
+		{ `let config = {"db": {"host": "localhost"}}; config?["cache"]?["host"]`, "null" },
+		{ `let config = {}; config?["cache"]?["host"] ?? "none"`, "none" },
+		{ `null?[0]`, "null" },
+		{ `[1, 2]?[1]`, "2" },
+		{ `null[0]`, "ERROR: index operator not supported: NULL" },
+		{ `let a = null; a?["x"]["y"]`, "null" },
+		{ `let a = null; a?["x"]["y"][0]["z"]`, "null" },
+		{ `let a = null; a?["f"](1)`, "null" },
+		{ `let a = null; a?["x"]["y"] ?? "none"`, "none" },
+		{ `let a = null; a?[undefined_name]["y"]`, "null" },
+		{ `let a = {"x": null}; a?["x"]["y"]`, "ERROR: index operator not supported: NULL" },
+		{ `let a = {"x": null}; a?["x"]?["y"]`, "null" },
+		{ `let a = {"f": fn(n) { n * 2 }}; a?["f"](4)`, "8" },
+		{ `let a = null; [a?["x"]["y"], a?["x"] == null]`, "[null, true]" },
+	}
+
+	CheckEvalTests(t, tests)
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []EvalTest{
+		{ `true ? 1 : 2`, "1" },
+		{ `null ? 1 : 2`, "2" },
+		{ `let x = 5; x > 3 ? "big" : x > 1 ? "medium" : "small"`, "big" },
+		{ `let x = 2; x > 3 ? "big" : x > 1 ? "medium" : "small"`, "medium" },
+		{ `match (1) { 0 => "zero", 1 => "one", _ => "many" }`, "one" },
+		{ `match (7) { 0 => "zero", 1 => "one", _ => "many" }`, "many" },
+		{ `match (-1) { -1 => "minus one", _ => "other" }`, "minus one" },
+		{ `match ("b") { "a" => 1, "b" => 2 }`, "2" },
+		{ `match (true) { false => 0, true => 1 }`, "1" },
+		{ `match (null) { null => "nothing", _ => "something" }`, "nothing" },
+		{ `match (3) { 1 => "one" }`, "null" },
+		{ `match (42) { n => n + 1 }`, "43" },
+		{ `match ([1, 2]) { [a, b] => a + b }`, "3" },
+		{ `match ([1, 2, 3]) { [a, b] => "pair", [a, b, c] => "triple" }`, "triple" },
+		{ `match ([1, 2, 3]) { [first, ...rest] => rest }`, "[2, 3]" },
+		{ `match ([1]) { [first, ...rest] => rest }`, "[]" },
+		{ `match ([]) { [first, ...rest] => "some", [] => "empty" }`, "empty" },
+		{ `match ([1, [2, 3]]) { [_, [_, x]] => x }`, "3" },
+		{ `match ([0, 5]) { [0, x] => x, _ => -1 }`, "5" },
+		{ `match ([1, 5]) { [0, x] => x, _ => -1 }`, "-1" },
+		{ `match ("str") { [x] => x, _ => "not an array" }`, "not an array" },
+		{ `match ({"name": "ann", "age": 30}) { {"name": n, "age": 30} => n }`, "ann" },
+		{ `match ({"name": "ann"}) { {"age": a} => a, {"name": n} => n }`, "ann" },
+		{ `match ({"kind": "circle", "r": 2}) { {"kind": "square", "side": s} => s * s, {"kind": "circle", "r": r} => 3 * r * r }`, "12" },
+		{ `match (10) { n if (n > 5) => "big", n => "small" }`, "big" },
+		{ `match (3) { n if n > 5 => "big", n => "small" }`, "small" },
+		{ `match ([4, 4]) { [a, b] if (a == b) => "same", _ => "different" }`, "same" },
+		{ `let n = 1; match (2) { n => n }; n`, "1" },
+		{ `match (1) { x + 1 => x }`, "ERROR: invalid pattern: (x + 1)" },
+		{ `match (1) { n if n + true => n }`, "ERROR: type mismatch: INTEGER + BOOLEAN" },
+		{ `...[1]`, "ERROR: spread operator not supported here: ...[1]" },
+	}
+
+	CheckEvalTests(t, tests)
+}
+
+func TestDestructuringLetStatement(t *testing.T) {
+	tests := []EvalTest{
+		{ `let [a, b] = [1, 2]; a + b`, "3" },
+		{ `let [a, b, ...rest] = [1, 2, 3, 4]; rest`, "[3, 4]" },
+		{ `let [a, ...rest] = [1]; rest`, "[]" },
+		{ `let [_, [x, y]] = [0, [1, 2]]; x * 10 + y`, "12" },
+		{ `let divmod = fn(a, b) { [a / b, a - (a / b) * b] }; let [q, r] = divmod(17, 5); [q, r]`, "[3, 2]" },
+		{ `let {name, age} = {"name": "ann", "age": 30, "city": "rome"}; [name, age]`, "[ann, 30]" },
+		{ `let {"name": n, "tags": [first, ...others]} = {"name": "ann", "tags": ["a", "b", "c"]}; [n, first, others]`, "[ann, a, [b, c]]" },
+		{ `let {1: one} = {1: "uno"}; one`, "uno" },
+		{ `let [a, b] = [1, 2, 3];`, "ERROR: wrong number of elements to destructure, got=3, want=2" },
+		{ `let [a, b, c, ...rest] = [1, 2];`, "ERROR: wrong number of elements to destructure, got=2, want at least 3" },
+		{ `let [a] = 5;`, "ERROR: cannot destructure INTEGER as ARRAY" },
+		{ `let {name} = [1];`, "ERROR: cannot destructure ARRAY as HASH" },
+		{ `let {name, age} = {"name": "ann"};`, "ERROR: missing key to destructure: age" },
+		{ `let sum = fn([a, b]) { a + b }; sum([3, 4])`, "7" },
+		{ `let greet = fn({name}, [greeting, ..._]) { greeting + " " + name }; greet({"name": "ann"}, ["hi", "hello"])`, "hi ann" },
+		{ `let sum = fn([a, b]) { a + b }; sum([3])`, "ERROR: wrong number of elements to destructure, got=1, want=2" },
+		{ `let name = fn({name}) { name }; name({})`, "ERROR: missing key to destructure: name" },
+	}
+
+	CheckEvalTests(t, tests)
+}
+
+func TestDefaultAndVariadicParameters(t *testing.T) {
+	tests := []EvalTest{
+		{ `let add = fn(x, y = 10) { x + y }; add(1)`, "11" },
+		{ `let add = fn(x, y = 10) { x + y }; add(1, 2)`, "3" },
+		{ `let f = fn(x, y = x * 2) { y }; f(4)`, "8" },
+		{ `let f = fn(x, [a, b] = [1, 2]) { x + a + b }; f(10)`, "13" },
+		{ `let f = fn(first, ...others) { others }; f(1, 2, 3)`, "[2, 3]" },
+		{ `let f = fn(first, ...others) { others }; f(1)`, "[]" },
+		{ `let f = fn(x = 1, ...others) { [x, others] }; f()`, "[1, []]" },
+		{ `let add = fn(x, y, z) { x + y + z }; add(...[1, 2, 3])`, "6" },
+		{ `let add = fn(x, y, z) { x + y + z }; add(1, ...[2], ...[3])`, "6" },
+		{ `let f = fn(...all) { all }; f(...[], 1, ...[2, 3])`, "[1, 2, 3]" },
+		{ `[0, ...[1, 2], 3]`, "[0, 1, 2, 3]" },
+		{ `len(...["abc"])`, "3" },
+		{ `let add = fn(x, y) { x + y }; add(1)`, "ERROR: wrong number of arguments to add, got=1, want=2" },
+		{ `let add = fn(x, y) { x + y }; add(1, 2, 3)`, "ERROR: wrong number of arguments to add, got=3, want=2" },
+		{ `let add = fn(x, y = 1) { x + y }; add()`, "ERROR: wrong number of arguments to add, got=0, want=1 to 2" },
+		{ `let f = fn(x, ...rest) { x }; f()`, "ERROR: wrong number of arguments to f, got=0, want=at least 1" },
+		{ `fn(x) { x }()`, "ERROR: wrong number of arguments to anonymous function, got=0, want=1" },
+		{ `let f = fn(x) { x }; f(...1)`, "ERROR: spread operator requires ARRAY, got INTEGER" },
+		{ `let f = fn(x, y = z) { x }; f(1)`, "ERROR: identifier not found: z" },
+	}
+
+	CheckEvalTests(t, tests)
+}
+
+func TestConstAndFreeze(t *testing.T) {
+	tests := []EvalTest{
+		{ `const x = 5; x`, "5" },
+		{ `const x = 5; let x = 6;`, "ERROR: cannot reassign constant x" },
+		{ `const x = 5; const x = 6;`, "ERROR: cannot reassign constant x" },
+		{ `const [a, b] = [1, 2]; let [c, a] = [3, 4];`, "ERROR: cannot reassign constant a" },
+		{ `const {name} = {"name": "ann"}; let name = "bob";`, "ERROR: cannot reassign constant name" },
+		{ `const x = 5; let f = fn() { let x = 6; x }; f()`, "6" },
+		{ `const x = 5; let f = fn(x) { x }; f(7)`, "7" },
+		{ `let x = 1; const x = 2; x`, "2" },
+		{ `let x = 1; const x = 2; let x = 3;`, "ERROR: cannot reassign constant x" },
+		{ `let config = freeze({"db": {"hosts": ["a"]}}); [is_frozen(config), is_frozen(config["db"]), is_frozen(config["db"]["hosts"])]`, "[true, true, true]" },
+		{ `let xs = [1, [2]]; freeze(xs); is_frozen(xs[1])`, "true" },
+		{ `is_frozen([1])`, "false" },
+		{ `is_frozen(push(freeze([1]), 2))`, "false" },
+		{ `is_frozen(merge(freeze({"a": 1}), {"b": 2}))`, "false" },
+		{ `let h = freeze({"a": 1, "b": 2}); [delete(h, "a"), is_frozen(delete(h, "a")), h]`, "[{b: 2}, false, {a: 1, b: 2}]" },
+		{ `freeze(5)`, "5" },
+	}
+
+	CheckEvalTests(t, tests)
+}
+
+func TestResolvedEvaluation(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{ `let x = 1; let y = x + 1; y`, "2" },
+		{ `let x = 1; let x = x + 1; x`, "2" },
+		{ `let adder = fn(a) { fn(b) { a + b } }; adder(2)(3)`, "5" },
+		{ `let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(10)`, "3628800" },
+		{ `let even = fn(n) { n == 0 ? true : odd(n - 1) }; let odd = fn(n) { n == 0 ? false : even(n - 1) }; even(10)`, "true" },
+		{ `let x = 1; let f = fn() { let y = x; let x = 2; [x, y] }; f()`, "[2, 1]" },
+		{ `let f = fn(a, b = a * 2, ...rest) { [a, b, rest] }; f(1)`, "[1, 2, []]" },
+		{ `let [a, [b, ...c]] = [1, [2, 3, 4]]; a + b + len(c)`, "5" },
+		{ `let f = fn(x) { match (x) { [h, ...t] if h > 0 => h + len(t), n => n } }; [f([1, 2]), f(7)]`, "[2, 7]" },
+		{ `if (true) { let z = 3 }; z`, "3" },
+		{ `let x = 5; quote(unquote(x) + 1)`, "QUOTE((5 + 1))" },
+		{ `infix |> 1 = fn(a, f) { f(a) }; let g = fn(x) { x |> fn(y) { y * 2 } }; g(4)`, "8" },
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := parser.NewParser(l)
+		program := p.ParseProgram()
+
+		r := resolver.NewResolver(nil, BuiltinNames())
+		if diagnostics := r.Resolve(program); resolver.HasErrors(diagnostics) {
+			t.Errorf("resolver errors for %q: %v", tt.input, diagnostics)
+			continue
+		}
+
+		evaluated := Eval(program, object.NewEnvironment())
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong result for %q, got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestEnvironmentSlots(t *testing.T) {
+	env := object.NewEnvironment()
+	inner := object.NewEnclosedEnvironment(env)
+
+	env.Set("a", TRUE)
+	env.SetSlot(2, "b", FALSE)
+	inner.SetSlot(0, "c", NULL)
+
+	if value, okay := inner.GetSlot(1, 2, "b"); !okay || value != FALSE {
+		t.Errorf("wrong slot lookup, got=%v", value)
+	}
+
+	if _, okay := inner.GetSlot(1, 1, "b"); okay {
+		t.Errorf("lookup of an empty slot succeeded")
+	}
+
+	if value, okay := inner.Get("b"); !okay || value != FALSE {
+		t.Errorf("wrong name lookup, got=%v", value)
+	}
+
+	env.Set("b", TRUE)
+	if value, _ := inner.GetSlot(1, 2, "b"); value != TRUE {
+		t.Errorf("Set did not update the slot of b")
+	}
+
+	names := env.Names()
+	if len(names) != 3 || names[0] != "a" || names[1] != "" || names[2] != "b" {
+		t.Errorf("wrong names, got=%v", names)
+	}
+}
+
+func TestTypeAnnotatedEvaluation(t *testing.T) {
+	tests := []EvalTest{
+		{ `let x: int = 5; x`, "5" },
+		{ `let f = fn(x: int, y: string = "a", ...rest: array) -> string { y }; f(1)`, "a" },
+		{ `let [a, b]: array = [1, 2]; a + b`, "3" },
+		{ `let f = fn(x: int) -> int { x }; f("not checked at run time")`, "not checked at run time" },
+	}
+
+	CheckEvalTests(t, tests)
+}
+
+func TestDeclaredOperators(t *testing.T) {
+	tests := []EvalTest{
+		{ `infix |> 1 = fn(a, f) { f(a) }; 5 |> fn(x) { x * 2 }`, "10" },
+		{ `infix |> 1 = fn(a, f) { f(a) }; 1 + 2 |> fn(x) { x * 10 } |> fn(x) { x + 1 }`, "31" },
+		{ `infix |> 1 = fn(a, b) { a - b }; 10 |> 3`, "7" },
+		{ `infix >>> 9 = fn(a, b) { a * 10 + b }; 1 >>> 2 >>> 3`, "123" },
+		{ `infix ** 11 right = fn(a, b) { if (b == 0) { 1 } else { a * a ** (b - 1) } }; 2 ** 3 ** 2`, "512" },
+		{ `infix -- 5 = fn(a, b) { a - b }; 10 -- 3 -- 2`, "5" },
+		{ `infix <> 3 = fn(a, b) { a + b }; let x = 1; let f = fn(y) { x <> y }; f(2)`, "3" },
+		{ `infix <> 3 = fn(a, b) { a + b }; let f = fn() { infix <> 3 = fn(a, b) { a - b }; 5 <> 1 }; [f(), 5 <> 1]`, "[4, 6]" },
+		{ `infix <> 3 = fn(a) { a }; 1 <> 2`, "ERROR: wrong number of arguments to infix <>, got=2, want=1" },
+		{ `infix <> 3 = 5; 1 <> 2`, "ERROR: not a function: INTEGER" },
+		{ `infix <> 3 = fn(a, b) { a }; undefined_name <> 2`, "ERROR: identifier not found: undefined_name" },
+		{ `let f = fn() { infix ^^ 2 = fn(a, b) { a } }; 1 ^^ 2`, "ERROR: operator ^^ is not defined here" },
+	}
+
+	CheckEvalTests(t, tests)
+}
+
+func TestPipelineAndComposition(t *testing.T) {
+	tests := []EvalTest{
+		{ `let double = fn(x) { x * 2 }; 5 |> double`, "10" },
+		{ `let add = fn(a, b) { a + b }; 5 |> add(1)`, "6" },
+		{ `[1, 2, 3, 4] |> map(fn(x) { x * x }) |> filter(fn(x) { x > 4 }) |> reduce(0, fn(a, b) { a + b })`, "25" },
+		{ `let sum = fn(xs) { reduce(xs, 0, fn(a, b) { a + b }) }; [1, 2, 3] |> sum`, "6" },
+		{ `1 + 2 |> fn(x) { x * 10 }`, "30" },
+		{ `let f = fn(a, ...rest) { [a, rest] }; 1 |> f(...[2, 3])`, "[1, [2, 3]]" },
+		{ `let adder = fn(a) { fn(b) { a + b } }; let add_two = adder(2); 1 |> add_two`, "3" },
+		{ `5 |> 3`, "ERROR: not a function: INTEGER" },
+		{ `5 |> undefined_name(1)`, "ERROR: identifier not found: undefined_name" },
+		{ `undefined_name |> len`, "ERROR: identifier not found: undefined_name" },
+		{ `let inc = fn(x) { x + 1 }; let double = fn(x) { x * 2 }; (inc >>> double)(3)`, "8" },
+		{ `let inc = fn(x) { x + 1 }; let double = fn(x) { x * 2 }; (double >>> inc)(3)`, "7" },
+		{ `let add = fn(a, b) { a + b }; let inc = fn(x) { x + 1 }; (add >>> inc >>> inc)(1, 2)`, "5" },
+		{ `[[1, 2], [3]] |> map(len >>> fn(n) { n * 10 })`, "[20, 10]" },
+		{ `let inc = fn(x) { x + 1 }; 1 |> inc >>> inc >>> inc`, "4" },
+		{ `let f = fn(x) { x } >>> fn(x, y) { x }; f(1)`, "ERROR: wrong number of arguments to anonymous function, got=1, want=2" },
+		{ `len >>> 1`, "ERROR: cannot compose BUILTIN >>> INTEGER, both must be functions" },
+		{ `1 >>> len`, "ERROR: cannot compose INTEGER >>> BUILTIN, both must be functions" },
+	}
+
+	CheckEvalTests(t, tests)
+}
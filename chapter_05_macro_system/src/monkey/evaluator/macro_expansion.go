@@ -1,32 +1,60 @@
 package evaluator
 
 import (
+	"fmt"
 	"monkey/ast"
 	"monkey/object"
+	"strings"
 )
 
 func DefineMacro(program *ast.Program, env *object.Environment) {
-    definitions := []int{}
+    program.Statements = DefineMacros(program.Statements, env)
+}
+
+// DefineMacros adds the macro definitions found among statements to env
+// and returns the remaining statements
+func DefineMacros(statements []ast.Statement, env *object.Environment) []ast.Statement {
+    remaining := []ast.Statement{}
 
-    for i, statement := range program.Statements {
+    for _, statement := range statements {
         if IsMacroDefinition(statement) {
             AddMacro(statement, env)
-            definitions = append(definitions, i)
+        } else {
+            remaining = append(remaining, statement)
+        }
+    }
+
+    return remaining
+}
+
+// DefineScopedMacros defines the macros of each nested block in an
+// environment enclosed by the one of the surrounding block, so that they are
+// only visible within that block. It records the environment seen by each
+// call in scopes. Macro bodies are left alone.
+func DefineScopedMacros(node ast.Node, env *object.Environment, scopes map[*ast.CallExpression]*object.Environment) {
+    switch node := node.(type) {
+    case *ast.BlockStatement:
+        for _, statement := range node.Statements {
+            if IsMacroDefinition(statement) {
+                env = object.NewEnclosedEnvironment(env)
+                node.Statements = DefineMacros(node.Statements, env)
+                break
+            }
         }
+    case *ast.CallExpression:
+        scopes[node] = env
+    case *ast.MacroLiteral:
+        return
     }
 
-    for i := len(definitions) - 1; i >= 0; i = i - 1 {
-        index := definitions[i]
-        program.Statements = append(
-            program.Statements[:index],
-            program.Statements[index+1:]...,
-        )
+    for _, child := range ast.Children(node) {
+        DefineScopedMacros(child, env, scopes)
     }
 }
 
 func IsMacroDefinition(node ast.Statement) bool {
     stmt, okay := node.(*ast.LetStatement)
-    if !okay {
+    if !okay || stmt.Name == nil {
         return false
     }
 
@@ -51,30 +79,305 @@ func AddMacro(stmt ast.Statement, env *object.Environment) {
     env.Set(let.Name.Value, macro)
 }
 
-func ExpandMacro(program ast.Node, env *object.Environment) ast.Node {
-    return ast.Modify(program, func(node ast.Node) ast.Node {
+// MaxExpansionDepth limits how many macro calls may be expanded one within
+// the output of the other, so that a macro expanding forever is reported
+var MaxExpansionDepth = 100
+
+// FormatChain joins the macros of a chain with arrows, collapsing the first
+// cycle repeated to its end, e.g. "main -> loop x100" or
+// "(ping -> pong) x2 -> ping"
+func FormatChain(chain []string) string {
+    for start := 0; start < len(chain); start++ {
+        for period := 1; 2 * period <= len(chain) - start; period++ {
+            if !Repeats(chain[start:], period) {
+                continue
+            }
+
+            count := (len(chain) - start) / period
+            cycle := strings.Join(chain[start:start + period], " -> ")
+            if period > 1 {
+                cycle = "(" + cycle + ")"
+            }
+
+            parts := append([]string{}, chain[:start]...)
+            parts = append(parts, fmt.Sprintf("%s x%d", cycle, count))
+            parts = append(parts, chain[start + count * period:]...)
+            return strings.Join(parts, " -> ")
+        }
+    }
+
+    return strings.Join(chain, " -> ")
+}
+
+// Repeats reports whether names repeats its first period names to its end
+func Repeats(names []string, period int) bool {
+    for i := period; i < len(names); i++ {
+        if names[i] != names[i - period] {
+            return false
+        }
+    }
+    return true
+}
+
+// ExpandMacro expands the calls to the macros of env, defined by
+// DefineMacro, and to the macros defined in nested blocks. The output of a
+// macro is expanded again until no macro calls remain.
+func ExpandMacro(program ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+    return ExpandMacroSteps(program, env, nil)
+}
+
+// ExpansionStep is the expansion of one macro call. Output is expanded
+// further once the step is traced, so it is only valid during the trace.
+type ExpansionStep struct {
+    Chain  []string     // the macro, after those whose output holds the call
+    Call   *ast.CallExpression
+    Output ast.Node
+}
+
+// ExpandMacroSteps is ExpandMacro calling trace, unless it is nil, for
+// each macro call it expands, in order
+func ExpandMacroSteps(program ast.Node, env *object.Environment, trace func(ExpansionStep)) (ast.Node, *object.Error) {
+    expander := &MacroExpander{scopes: map[*ast.CallExpression]*object.Environment{}, trace: trace}
+    DefineScopedMacros(program, env, expander.scopes)
+
+    expanded := expander.Expand(program, env, []string{})
+    if expander.err != nil {
+        return nil, expander.err
+    }
+
+    return expanded, nil
+}
+
+type MacroExpander struct {
+    scopes map[*ast.CallExpression]*object.Environment
+    trace func(ExpansionStep)
+    err *object.Error
+}
+
+// Expand expands the macro calls in node, chain lists the macros whose
+// output node is part of
+func (e *MacroExpander) Expand(node ast.Node, env *object.Environment, chain []string) ast.Node {
+    expanded, err := ast.Modify(node, func(node ast.Node) ast.Node {
         call, okay := node.(*ast.CallExpression)
-        if !okay {
+        if !okay || e.err != nil {
             return node
         }
 
-        macro, okay := IsMacroCall(call, env)
+        scope, okay := e.scopes[call]
+        if !okay {
+            scope = env
+        }
+
+        macro, okay := IsMacroCall(call, scope)
         if !okay {
             return node
         }
 
+        name := call.Function.(*ast.Identifier).Value
+        chain := append(chain[:len(chain):len(chain)], name)
+
+        if len(chain) > MaxExpansionDepth {
+            e.err = NewError("macro expansion deeper than %d: %s", MaxExpansionDepth, FormatChain(chain))
+            return node
+        }
+
+        if len(call.Arguments) != len(macro.Parameters) {
+            e.err = NewError("wrong number of arguments to macro %s, got=%d, want=%d", name, len(call.Arguments), len(macro.Parameters))
+            return node
+        }
+
         args := QuoteArgs(call)
         env := ExtendMacroEnv(macro, args)
 
         evaluated := Eval(macro.Body, env)
 
+        if err, okay := evaluated.(*object.Error); okay {
+            e.err = NewError("error expanding %s: %s", FormatChain(chain), err.Message)
+            return node
+        }
+
         quote, okay := evaluated.(*object.Quote)
         if !okay {
-            panic("we only support returning AST-nodes from macros")
+            e.err = NewError("macro %s must return a QUOTE, got %s", name, TypeOf(evaluated))
+            return node
+        }
+
+        // the output can define and call further macros, looked up from
+        // the block of the call
+        expanded := Hygiene(quote)
+        if e.trace != nil {
+            e.trace(ExpansionStep{Chain: chain, Call: call, Output: expanded})
         }
+        DefineScopedMacros(expanded, scope, e.scopes)
 
-        return quote.Node
+        return e.Expand(expanded, scope, chain)
     })
+
+    if err != nil {
+        if e.err == nil {
+            e.err = NewError("%s", err.Error())
+        }
+        return node
+    }
+
+    return expanded
+}
+
+// TypeOf returns the type of obj, which may be nil
+func TypeOf(obj object.Object) object.ObjectType {
+    if obj == nil {
+        return "nil"
+    }
+    return obj.Type()
+}
+
+// Hygiene renames the identifiers bound by the code a macro introduced to
+// fresh symbols, so that they can neither capture nor shadow the names of
+// the caller. Code spliced in by unquote is left as it is. Uses are renamed
+// only where they refer to a renamed binding, following the scopes as the
+// resolver does.
+func Hygiene(quote *object.Quote) ast.Node {
+    exempt := map[*ast.Identifier]bool{}
+    for _, node := range quote.Spliced {
+        VisitIdentifiers(node, func(identifier *ast.Identifier) {
+            exempt[identifier] = true
+        })
+    }
+
+    h := &HygieneRenamer{exempt: exempt}
+    scope := &HygieneScope{names: map[string]string{}}
+    h.Rename(quote.Node, scope)
+    h.CloseScope(scope)
+
+    return quote.Node
+}
+
+// HygieneScope maps the names bound in a scope of quoted code to the names
+// they were renamed to. Function bodies are renamed when the scope they are
+// in closes, as they may use names bound after them.
+type HygieneScope struct {
+    names    map[string]string
+    outer    *HygieneScope
+    deferred []func()
+}
+
+type HygieneRenamer struct {
+    exempt map[*ast.Identifier]bool
+}
+
+func (h *HygieneRenamer) Rename(node ast.Node, scope *HygieneScope) {
+    switch node := node.(type) {
+    case *ast.Identifier:
+        if h.exempt[node] {
+            return
+        }
+        for s := scope; s != nil; s = s.outer {
+            if name, okay := s.names[node.Value]; okay {
+                SetIdentifier(node, name)
+                return
+            }
+        }
+
+    case *ast.LetStatement:
+        h.Rename(node.Value, scope)
+        if node.Pattern != nil {
+            h.Bind(PatternIdentifiers(node.Pattern), scope)
+        } else {
+            h.Bind(PatternIdentifiers(node.Name), scope)
+        }
+
+    case *ast.InfixDeclaration:
+        // the operator keeps its name
+        h.Rename(node.Function, scope)
+
+    case *ast.FunctionLiteral:
+        inner := &HygieneScope{names: map[string]string{}, outer: scope}
+        scope.deferred = append(scope.deferred, func() {
+            for _, param := range node.Parameters {
+                if dp, okay := param.(*ast.DefaultParameter); okay {
+                    h.Rename(dp.Default, inner)
+                }
+                h.Bind(PatternIdentifiers(param), inner)
+            }
+            h.Rename(node.Body, inner)
+            h.CloseScope(inner)
+        })
+
+    case *ast.MatchArm:
+        inner := &HygieneScope{names: map[string]string{}, outer: scope}
+        h.Bind(MatchPatternIdentifiers(node.Pattern), inner)
+        if node.Guard != nil {
+            h.Rename(node.Guard, inner)
+        }
+        h.Rename(node.Body, inner)
+        h.CloseScope(inner)
+
+    default:
+        for _, child := range ast.Children(node) {
+            h.Rename(child, scope)
+        }
+    }
+}
+
+// Bind declares identifiers in scope, renaming those the macro introduced.
+// Spliced ones keep their name, and hide the renamed names of outer scopes.
+func (h *HygieneRenamer) Bind(identifiers []*ast.Identifier, scope *HygieneScope) {
+    for _, identifier := range identifiers {
+        if h.exempt[identifier] {
+            scope.names[identifier.Value] = identifier.Value
+            continue
+        }
+
+        name, okay := scope.names[identifier.Value]
+        if !okay {
+            name = Gensym(identifier.Value)
+            scope.names[identifier.Value] = name
+        }
+        SetIdentifier(identifier, name)
+    }
+}
+
+func (h *HygieneRenamer) CloseScope(scope *HygieneScope) {
+    for len(scope.deferred) > 0 {
+        deferred := scope.deferred
+        scope.deferred = nil
+        for _, rename := range deferred {
+            rename()
+        }
+    }
+}
+
+func SetIdentifier(identifier *ast.Identifier, name string) {
+    identifier.Value = name
+    identifier.Token.Literal = name
+}
+
+// MatchPatternIdentifiers is like PatternIdentifiers for match patterns,
+// which can also hold literals
+func MatchPatternIdentifiers(pattern ast.Expression) []*ast.Identifier {
+    if _, okay := pattern.(*ast.PrefixExpression); okay {
+        return nil
+    }
+    return PatternIdentifiers(pattern)
+}
+
+func VisitIdentifiers(node ast.Node, visit func(*ast.Identifier)) {
+    ast.Inspect(node, func(node ast.Node) bool {
+        if identifier, okay := node.(*ast.Identifier); okay {
+            visit(identifier)
+        }
+        return true
+    })
+}
+
+// GensymCount numbers the symbols made by Gensym
+var GensymCount = 0
+
+// Gensym returns a fresh name starting with prefix. Identifiers cannot
+// contain digits in source code, so the name cannot clash with the user's.
+func Gensym(prefix string) string {
+    GensymCount += 1
+    return fmt.Sprintf("%s__%d", prefix, GensymCount)
 }
 
 func IsMacroCall(exp *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
@@ -100,7 +403,7 @@ func QuoteArgs(exp *ast.CallExpression) []*object.Quote {
     args := []*object.Quote{}
 
     for _, arg := range exp.Arguments {
-        args = append(args, &object.Quote{Node: arg})
+        args = append(args, &object.Quote{Node: arg, Spliced: []ast.Node{arg}})
     }
 
     return args
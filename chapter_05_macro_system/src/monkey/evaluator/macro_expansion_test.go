@@ -5,6 +5,8 @@ import (
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -99,10 +101,412 @@ func TestExpandMacro(t *testing.T) {
 
         env := object.NewEnvironment()
         DefineMacro(program, env)
-        expanded := ExpandMacro(program, env)
+        expanded, err := ExpandMacro(program, env)
+        if err != nil {
+            t.Fatalf("expansion failed for %q: %s", tt.input, err.Message)
+        }
 
         if expanded.String() != expected.String() {
             t.Errorf("not equal, want=%q, got=%q", expected.String(), expanded.String())
         }
     }
-}
\ No newline at end of file
+}
+
+func TestMacroHygiene(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected string
+    }{
+        {
+            `let sign = macro(value) {
+                quote(match (unquote(value)) { 0 => "zero", n if (n < 0) => "negative", _ => "positive" });
+            };
+            sign(2 - 3);`,
+            `match ((2 - 3)) { 0 => zero, n__1 if (n__1 < 0) => negative, _ => positive }`,
+        },
+        {
+            `let twice = macro(value) { quote(if (true) { let x = unquote(value); x + x }) };
+            twice(x * 2)`,
+            `if true let x__1 = (x * 2);(x__1 + x__1)`,
+        },
+        {
+            `let wrap = macro(body) { quote(fn(n, m = n) { unquote(body) }) };
+            wrap(n + m)`,
+            `fn(n__1, m__2 = n__1) (n + m)`,
+        },
+        {
+            `let named = macro() { let name = gensym("tmp"); quote(unquote(name) + 1) };
+            named()`,
+            `(tmp__1 + 1)`,
+        },
+    }
+
+    for _, tt := range tests {
+        GensymCount = 0
+        program := CheckParseProgram(tt.input)
+
+        env := object.NewEnvironment()
+        DefineMacro(program, env)
+        expanded, err := ExpandMacro(program, env)
+        if err != nil {
+            t.Fatalf("expansion failed for %q: %s", tt.input, err.Message)
+        }
+
+        if expanded.String() != tt.expected {
+            t.Errorf("not equal, want=%q, got=%q", tt.expected, expanded.String())
+        }
+    }
+}
+
+func TestHygienicEvaluation(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected string
+    }{
+        {
+            `let double_plus_one = macro(value) { quote(if (true) { let x = unquote(value) * 2; x + 1 }) };
+            let x = 5;
+            double_plus_one(x) + x`,
+            "16",
+        },
+        {
+            `let first_match = macro(body) { quote(match (1) { n => unquote(body) }) };
+            let n = 7;
+            first_match(n + 1)`,
+            "8",
+        },
+        {
+            `let x = 10;
+            let m = macro() { quote(fn(x) { x }(1) + x) };
+            m()`,
+            "11",
+        },
+        {
+            `let add_one = macro(a) { quote(unquote(a) + 1) };
+            add_one(5) * 10 + add_one(10)`,
+            "71",
+        },
+        {
+            `gensym("tmp") == gensym("tmp")`,
+            "false",
+        },
+        {
+            `gensym(1)`,
+            "ERROR: builtin gensym argument must be STRING, got INTEGER",
+        },
+    }
+
+    for _, tt := range tests {
+        program := CheckParseProgram(tt.input)
+
+        env := object.NewEnvironment()
+        DefineMacro(program, env)
+        expanded, err := ExpandMacro(program, env)
+        if err != nil {
+            t.Fatalf("expansion failed for %q: %s", tt.input, err.Message)
+        }
+        evaluated := Eval(expanded, object.NewEnvironment())
+
+        if evaluated.Inspect() != tt.expected {
+            t.Errorf("wrong result for %q, got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+        }
+    }
+}
+
+func TestScopedMacros(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected string
+    }{
+        {
+            `let f = fn(x) { let double = macro(a) { quote(unquote(a) * 2) }; double(x) + 1 };
+            f(5)`,
+            "11",
+        },
+        {
+            `let m = macro() { quote(1) };
+            let f = fn() { let m = macro() { quote(2) }; m() };
+            [m(), f(), m()]`,
+            "[1, 2, 1]",
+        },
+        {
+            `if (true) { let m = macro() { quote(3) }; m() }`,
+            "3",
+        },
+        {
+            `if (true) { let m = macro() { quote(3) }; m() }; m()`,
+            "ERROR: identifier not found: m",
+        },
+        {
+            `let outer = macro(a) { quote(unquote(a) + 10) };
+            let f = fn() { let inner = macro(a) { quote(unquote(a) * 2) }; if (true) { inner(2) + outer(1) } };
+            f()`,
+            "15",
+        },
+        {
+            `let outer = macro(a) { quote(unquote(a) + 10) };
+            let f = fn() { let inner = macro(a) { quote(unquote(a) * 2) }; outer(inner(2)) };
+            f()`,
+            "14",
+        },
+        {
+            `let f = fn() { m() + 1; let m = macro() { quote(4) } };
+            f()`,
+            "5",
+        },
+    }
+
+    for _, tt := range tests {
+        program := CheckParseProgram(tt.input)
+
+        env := object.NewEnvironment()
+        DefineMacro(program, env)
+        expanded, err := ExpandMacro(program, env)
+        if err != nil {
+            t.Fatalf("expansion failed for %q: %s", tt.input, err.Message)
+        }
+        evaluated := Eval(expanded, object.NewEnvironment())
+
+        if evaluated.Inspect() != tt.expected {
+            t.Errorf("wrong result for %q, got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+        }
+    }
+}
+
+func TestRecursiveExpansion(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected string
+    }{
+        {
+            `let double = macro(a) { quote(unquote(a) * 2) };
+            let eight = macro() { quote(double(double(2))) };
+            eight()`,
+            "((2 * 2) * 2)",
+        },
+        {
+            `let double = macro(a) { quote(unquote(a) * 2) };
+            let quadruple = macro(a) { quote(double(double(unquote(a)))) };
+            quadruple(3)`,
+            "((3 * 2) * 2)",
+        },
+        {
+            `let double = macro(a) { quote(unquote(a) * 2) };
+            puts(double(1), [double(2)])`,
+            "puts((1 * 2), [(2 * 2)])",
+        },        {
+            `let do_all = macro(a, b, c) { quote(if (true) { unquote_splice([a, b, c]) }) };
+            let double = macro(a) { quote(unquote(a) * 2) };
+            do_all(puts(1), double(2), 3)`,
+            "if true puts(1)(2 * 2)3",
+        },
+    }
+
+    for _, tt := range tests {
+        program := CheckParseProgram(tt.input)
+        env := object.NewEnvironment()
+        DefineMacro(program, env)
+
+        expanded, err := ExpandMacro(program, env)
+        if err != nil {
+            t.Fatalf("expansion failed for %q: %s", tt.input, err.Message)
+        }
+
+        if expanded.String() != tt.expected {
+            t.Errorf("wrong expansion, got=%q, want=%q", expanded.String(), tt.expected)
+        }
+    }
+}
+
+func TestExpansionErrors(t *testing.T) {
+    defer func(depth int) { MaxExpansionDepth = depth }(MaxExpansionDepth)
+    MaxExpansionDepth = 4
+
+    tests := []struct {
+        input    string
+        expected string
+    }{
+        {
+            `let loop = macro() { quote(loop()) }; loop()`,
+            "macro expansion deeper than 4: loop x5",
+        },
+        {
+            `let ping = macro() { quote(1 + pong()) }; let pong = macro() { quote(ping()) }; ping()`,
+            "macro expansion deeper than 4: (ping -> pong) x2 -> ping",
+        },
+        {
+            `let loop = macro() { quote(loop()) }; let main = macro() { quote(loop()) }; main()`,
+            "macro expansion deeper than 4: main -> loop x4",
+        },
+        {
+            `let bad = macro() { 1 }; bad()`,
+            "macro bad must return a QUOTE, got INTEGER",
+        },
+        {
+            `let bad = macro() { missing }; let outer = macro() { quote(bad()) }; outer()`,
+            "error expanding outer -> bad: identifier not found: missing",
+        },
+        {
+            `let m = macro(a) { a }; m()`,
+            "wrong number of arguments to macro m, got=0, want=1",
+        },
+    }
+
+    for _, tt := range tests {
+        program := CheckParseProgram(tt.input)
+        env := object.NewEnvironment()
+        DefineMacro(program, env)
+
+        _, err := ExpandMacro(program, env)
+        if err == nil {
+            t.Errorf("no error for %q", tt.input)
+            continue
+        }
+
+        if err.Message != tt.expected {
+            t.Errorf("wrong error for %q, got=%q, want=%q", tt.input, err.Message, tt.expected)
+        }
+    }
+}
+
+func TestExpansionSteps(t *testing.T) {
+    input := `let double = macro(a) { quote(unquote(a) * 2) };
+    let quadruple = macro(a) { quote(double(double(unquote(a)))) };
+    quadruple(3) + double(1)`
+
+    program := CheckParseProgram(input)
+    env := object.NewEnvironment()
+    DefineMacro(program, env)
+
+    steps := []string{}
+    trace := func(step ExpansionStep) {
+        steps = append(steps, strings.Join(step.Chain, " -> ") + ": " + ast.Format(step.Call) + " => " + ast.Format(step.Output))
+    }
+
+    expanded, err := ExpandMacroSteps(program, env, trace)
+    if err != nil {
+        t.Fatalf("expansion failed: %s", err.Message)
+    }
+
+    expected := []string{
+        "quadruple: quadruple(3) => double(double(3))",
+        "quadruple -> double: double(3) => 3 * 2",
+        "quadruple -> double: double(3 * 2) => (3 * 2) * 2",
+        "double: double(1) => 1 * 2",
+    }
+
+    if len(steps) != len(expected) {
+        t.Fatalf("wrong number of steps, got=%q", steps)
+    }
+
+    for i, step := range steps {
+        if step != expected[i] {
+            t.Errorf("wrong step %d, got=%q, want=%q", i, step, expected[i])
+        }
+    }
+
+    if ast.Format(expanded) != "((3 * 2) * 2) + (1 * 2);" {
+        t.Errorf("wrong expansion, got=%q", ast.Format(expanded))
+    }
+}
+
+func TestASTBuiltins(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected string
+    }{
+        { `ast_type(quote(f(1)))`, "CallExpression" },
+        { `ast_type(quote(x))`, "Identifier" },
+        { `ast_type(quote(if (x) { 1 }))`, "IfExpression" },
+        { `ast_children(quote(f(1, a)))`, "[QUOTE(f), QUOTE(1), QUOTE(a)]" },
+        { `ast_children(quote(1))`, "[]" },
+        { `ast_name(quote(f(1)))`, "f" },
+        { `ast_name(quote(1))`, "null" },
+        { `make_call("push", [[1], quote(2 + 3)])`, "QUOTE(push([1], (2 + 3)))" },
+        { `make_ident("abc")`, "QUOTE(abc)" },
+        {
+            `let wrap = macro(e) { if (ast_type(e) == "CallExpression") { make_call("len", [ast_name(e)]) } else { e } };
+            [wrap(first([1])), wrap(5)]`,
+            "[5, 5]",
+        },
+        {
+            `let apply = macro() { make_call(quote(fn(x) { x * 2 }), [21]) };
+            apply()`,
+            "42",
+        },
+        {
+            `let args = macro(e) { make_call(make_ident("push"), ast_children(e)) };
+            let a = [1];
+            args(a + 2)`,
+            "[1, 2]",
+        },
+        { `ast_type(1)`, "ERROR: builtin ast_type argument must be QUOTE, got INTEGER" },
+        { `make_ident("if")`, `ERROR: not a valid identifier: "if"` },
+        { `make_call(1, [])`, "ERROR: builtin make_call first argument must be STRING or QUOTE, got INTEGER" },
+        { `make_call("f", [len])`, "ERROR: cannot unquote BUILTIN, it has no literal form" },
+    }
+
+    for _, tt := range tests {
+        program := CheckParseProgram(tt.input)
+
+        env := object.NewEnvironment()
+        DefineMacro(program, env)
+        expanded, err := ExpandMacro(program, env)
+        if err != nil {
+            t.Fatalf("expansion failed for %q: %s", tt.input, err.Message)
+        }
+        evaluated := Eval(expanded, object.NewEnvironment())
+
+        if evaluated.Inspect() != tt.expected {
+            t.Errorf("wrong result for %q, got=%q, want=%q", tt.input, evaluated.Inspect(), tt.expected)
+        }
+    }
+}
+
+func TestSubQuote(t *testing.T) {
+    call := CheckParseProgram(`f(g(x), y)`).Statements[0].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+    quote := &object.Quote{Node: call, Spliced: []ast.Node{call.Arguments[0]}}
+
+    inner := SubQuote(quote, call.Arguments[0].(*ast.CallExpression).Arguments[0])
+    if len(inner.Spliced) != 1 || inner.Spliced[0] != inner.Node {
+        t.Errorf("a part of spliced code must be spliced, got=%v", inner.Spliced)
+    }
+
+    outside := SubQuote(quote, call.Arguments[1])
+    if len(outside.Spliced) != 0 {
+        t.Errorf("expected nothing spliced, got=%v", outside.Spliced)
+    }
+
+    whole := SubQuote(quote, call)
+    if len(whole.Spliced) != 1 || whole.Spliced[0] != call.Arguments[0] {
+        t.Errorf("expected the spliced argument, got=%v", whole.Spliced)
+    }
+}
+
+func TestFormatChain(t *testing.T) {
+    tests := []struct {
+        chain    []string
+        expected string
+    }{
+        {[]string{"m"}, "m"},
+        {[]string{"a", "b"}, "a -> b"},
+        {[]string{"a", "b", "a"}, "a -> b -> a"},
+        {[]string{"loop", "loop"}, "loop x2"},
+        {[]string{"main", "loop", "loop", "loop"}, "main -> loop x3"},
+        {[]string{"a", "b", "c", "b", "c", "b"}, "a -> (b -> c) x2 -> b"},
+    }
+
+    for _, tt := range tests {
+        if formatted := FormatChain(tt.chain); formatted != tt.expected {
+            t.Errorf("wrong chain for %v, got=%q, want=%q", tt.chain, formatted, tt.expected)
+        }
+    }
+
+    loop := []string{}
+    for i := 0; i <= MaxExpansionDepth; i++ {
+        loop = append(loop, "loop")
+    }
+    if formatted := FormatChain(loop); formatted != "loop x" + strconv.Itoa(MaxExpansionDepth + 1) {
+        t.Errorf("wrong chain for the depth limit, got=%q", formatted)
+    }
+}
@@ -0,0 +1,153 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+func EvalConditionalExpression(ce *ast.ConditionalExpression, env *object.Environment) object.Object {
+	condition := Eval(ce.Condition, env)
+	if IsError(condition) {
+		return condition
+	}
+
+	if IsTruthy(condition) {
+		return Eval(ce.Consequence, env)
+	}
+	return Eval(ce.Alternative, env)
+}
+
+// EvalMatchExpression tries the arms in order and evaluates the body of the
+// first one whose pattern matches and whose guard holds. Bindings made by the
+// pattern are only visible to the guard and body of that arm.
+func EvalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(me.Subject, env)
+	if IsError(subject) {
+		return subject
+	}
+
+	for _, arm := range me.Arms {
+		ArmEnv := object.NewEnclosedEnvironment(env)
+
+		matched, err := MatchPattern(arm.Pattern, subject, ArmEnv)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, ArmEnv)
+			if IsError(guard) {
+				return guard
+			}
+			if !IsTruthy(guard) {
+				continue
+			}
+		}
+
+		return Eval(arm.Body, ArmEnv)
+	}
+
+	return NULL
+}
+
+// MatchPattern reports whether value has the shape described by pattern and
+// binds the identifiers found in the pattern into env. The identifier _ matches
+// anything without binding it.
+func MatchPattern(pattern ast.Expression, value object.Object, env *object.Environment) (bool, *object.Error) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			Bind(pattern, value, env)
+		}
+		return true, nil
+
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean, *ast.NullLiteral:
+		return object.Equal(Eval(pattern, env), value), nil
+
+	case *ast.PrefixExpression:
+		if _, okay := pattern.Operand.(*ast.IntegerLiteral); !okay || pattern.Operator != "-" {
+			return false, NewError("invalid pattern: %s", pattern.String())
+		}
+		return object.Equal(Eval(pattern, env), value), nil
+
+	case *ast.ArrayLiteral:
+		return MatchArrayPattern(pattern, value, env)
+
+	case *ast.HashLiteral:
+		return MatchHashPattern(pattern, value, env)
+
+	default:
+		return false, NewError("invalid pattern: %s", pattern.String())
+	}
+}
+
+func MatchArrayPattern(pattern *ast.ArrayLiteral, value object.Object, env *object.Environment) (bool, *object.Error) {
+	array, okay := value.(*object.Array)
+	if !okay {
+		return false, nil
+	}
+
+	elements := pattern.Elements
+	var rest *ast.SpreadExpression
+
+	if size := len(elements); size > 0 {
+		if spread, okay := elements[size - 1].(*ast.SpreadExpression); okay {
+			rest = spread
+			elements = elements[:size - 1]
+		}
+	}
+
+	if len(array.Elements) < len(elements) || (rest == nil && len(array.Elements) != len(elements)) {
+		return false, nil
+	}
+
+	for i, element := range elements {
+		matched, err := MatchPattern(element, array.Elements[i], env)
+		if err != nil || !matched {
+			return matched, err
+		}
+	}
+
+	if rest != nil {
+		remaining := make([]object.Object, len(array.Elements) - len(elements))
+		copy(remaining, array.Elements[len(elements):])
+		return MatchPattern(rest.Value, &object.Array{Elements: remaining}, env)
+	}
+
+	return true, nil
+}
+
+// MatchHashPattern matches hashes having at least the keys in the pattern,
+// extra keys are ignored
+func MatchHashPattern(pattern *ast.HashLiteral, value object.Object, env *object.Environment) (bool, *object.Error) {
+	hash, okay := value.(*object.Hash)
+	if !okay {
+		return false, nil
+	}
+
+	for _, k := range pattern.Keys {
+		key := Eval(k, env)
+		if err, okay := key.(*object.Error); okay {
+			return false, err
+		}
+
+		if !object.IsHashable(key) {
+			return false, NewError("unusable as hash key: %s", key.Type())
+		}
+
+		pair, okay := hash.Get(key)
+		if !okay {
+			return false, nil
+		}
+
+		matched, err := MatchPattern(pattern.Pairs[k], pair.Value, env)
+		if err != nil || !matched {
+			return matched, err
+		}
+	}
+
+	return true, nil
+}
@@ -3,18 +3,47 @@ package evaluator
 import (
 	"fmt"
 	"monkey/ast"
+	"monkey/lexer"
 	"monkey/object"
 	"monkey/token"
+	"strings"
 )
 
+// quote works on a copy of node, which belongs to the code being evaluated
+// and may be quoted again, as the body of a macro is at each expansion
 func quote(node ast.Node, env *object.Environment) object.Object {
-	node = EvalUnquoteCall(node, env)
-	return &object.Quote{Node: node}
+	node, spliced, err := EvalUnquoteCall(ast.Copy(node), env)
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node, Spliced: spliced}
 }
 
-func EvalUnquoteCall(quoted ast.Node, env *object.Environment) ast.Node {
+// EvalUnquoteCall replaces the unquote calls in quoted by their value, and
+// the unquote_splice calls in array literals, call arguments and blocks by
+// the elements of theirs. It also returns the inserted nodes.
+func EvalUnquoteCall(quoted ast.Node, env *object.Environment) (ast.Node, []ast.Node, *object.Error) {
+	spliced := []ast.Node{}
+	var failed *object.Error
+
 	modifier := func(node ast.Node) ast.Node {
-		if !IsUnquoteCall(node) {
+		if failed != nil {
+			return node
+		}
+
+		var inserted []ast.Node
+
+		switch node := node.(type) {
+		case *ast.ArrayLiteral:
+			node.Elements, inserted, failed = SpliceExpressions(node.Elements, env)
+		case *ast.CallExpression:
+			node.Arguments, inserted, failed = SpliceExpressions(node.Arguments, env)
+		case *ast.BlockStatement:
+			node.Statements, inserted, failed = SpliceStatements(node.Statements, env)
+		}
+		spliced = append(spliced, inserted...)
+
+		if failed != nil || !IsUnquoteCall(node) {
 			return node
 		}
 
@@ -27,10 +56,128 @@ func EvalUnquoteCall(quoted ast.Node, env *object.Environment) ast.Node {
 			return node
 		}
 
-		unquoted := Eval(call.Arguments[0], env)
-		return FromObjectToASTNode(unquoted)
+		unquoted, err := FromObjectToASTNode(Eval(call.Arguments[0], env))
+		if err != nil {
+			failed = err
+			return node
+		}
+		spliced = append(spliced, unquoted)
+		return unquoted
+	}
+
+	modified, err := ast.Modify(quoted, modifier)
+	if failed != nil {
+		return nil, nil, failed
+	}
+	if err != nil {
+		return nil, nil, NewError("%s", err.Error())
+	}
+
+	// whatever is left was not in a list it could be spliced into
+	ast.Inspect(modified, func(node ast.Node) bool {
+		if failed == nil && IsUnquoteSpliceCall(node) {
+			failed = NewError("unquote_splice outside of an array, call arguments or block: %s", node.String())
+		}
+		return failed == nil
+	})
+	if failed != nil {
+		return nil, nil, failed
+	}
+
+	return modified, spliced, nil
+}
+
+// EvalUnquoteSplice returns the nodes for the elements of the array the
+// argument of an unquote_splice call evaluates to
+func EvalUnquoteSplice(call *ast.CallExpression, env *object.Environment) ([]ast.Node, *object.Error) {
+	if len(call.Arguments) != 1 {
+		return nil, NewError("wrong number of arguments to unquote_splice, got=%d, want=1", len(call.Arguments))
+	}
+
+	evaluated := Eval(call.Arguments[0], env)
+	if err, okay := evaluated.(*object.Error); okay {
+		return nil, err
+	}
+
+	array, okay := evaluated.(*object.Array)
+	if !okay {
+		return nil, NewError("unquote_splice argument must be ARRAY, got %s", TypeOf(evaluated))
 	}
-	return ast.Modify(quoted, modifier)
+
+	nodes := []ast.Node{}
+	for _, element := range array.Elements {
+		node, err := FromObjectToASTNode(element)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+// SpliceExpressions replaces the unquote_splice calls among expressions
+func SpliceExpressions(expressions []ast.Expression, env *object.Environment) ([]ast.Expression, []ast.Node, *object.Error) {
+	result := []ast.Expression{}
+	inserted := []ast.Node{}
+
+	for _, expression := range expressions {
+		call, okay := expression.(*ast.CallExpression)
+		if !okay || !IsUnquoteSpliceCall(call) {
+			result = append(result, expression)
+			continue
+		}
+
+		nodes, err := EvalUnquoteSplice(call, env)
+		if err != nil {
+			return expressions, nil, err
+		}
+
+		for _, node := range nodes {
+			element, okay := node.(ast.Expression)
+			if !okay {
+				return expressions, nil, NewError("cannot splice %s into %s, it is not an expression", node.String(), call.String())
+			}
+			result = append(result, element)
+			inserted = append(inserted, node)
+		}
+	}
+
+	return result, inserted, nil
+}
+
+// SpliceStatements replaces the statements made of an unquote_splice call,
+// the expressions it inserts become expression statements
+func SpliceStatements(statements []ast.Statement, env *object.Environment) ([]ast.Statement, []ast.Node, *object.Error) {
+	result := []ast.Statement{}
+	inserted := []ast.Node{}
+
+	for _, statement := range statements {
+		es, okay := statement.(*ast.ExpressionStatement)
+		if !okay || !IsUnquoteSpliceCall(es.Expression) {
+			result = append(result, statement)
+			continue
+		}
+
+		nodes, err := EvalUnquoteSplice(es.Expression.(*ast.CallExpression), env)
+		if err != nil {
+			return statements, nil, err
+		}
+
+		for _, node := range nodes {
+			switch node := node.(type) {
+			case ast.Statement:
+				result = append(result, node)
+			case ast.Expression:
+				result = append(result, &ast.ExpressionStatement{Token: es.Token, Expression: node})
+			default:
+				return statements, nil, NewError("cannot splice %s into a block, it is not a statement", node.String())
+			}
+			inserted = append(inserted, node)
+		}
+	}
+
+	return result, inserted, nil
 }
 
 func IsUnquoteCall(node ast.Node) bool {
@@ -41,25 +188,167 @@ func IsUnquoteCall(node ast.Node) bool {
 	return call.Function.TokenLiteral() == "unquote"
 }
 
-func FromObjectToASTNode(obj object.Object) ast.Node {
+func IsUnquoteSpliceCall(node ast.Node) bool {
+	call, okay := node.(*ast.CallExpression)
+	if !okay {
+		return false
+	}
+	return call.Function.TokenLiteral() == "unquote_splice"
+}
+
+// FromObjectToASTNode turns a value back into the literal that evaluates
+// to it, so that it can be inserted into quoted code
+func FromObjectToASTNode(obj object.Object) (ast.Node, *object.Error) {
 	switch obj := obj.(type) {
 	case *object.Integer:
 		t := token.Token{
 			Type:    token.INT,
-			Literal: fmt.Sprintf("%d", obj.Value),
+			Literal: obj.Inspect(),
 		}
-		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value, Big: obj.Big}, nil
+
 	case *object.Boolean:
-        var t token.Token
-        if obj.Value {
-            t = token.Token{Type: token.TRUE, Literal: "true"}
-        } else {
-            t = token.Token{Type: token.FALSE, Literal: "false"}
-        }
-		return &ast.Boolean{Token: t, Value: obj.Value}
-    case *object.Quote:
-        return obj.Node
+		var t token.Token
+		if obj.Value {
+			t = token.Token{Type: token.TRUE, Literal: "true"}
+		} else {
+			t = token.Token{Type: token.FALSE, Literal: "false"}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}, nil
+
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}, nil
+
+	case *object.Null:
+		return &ast.NullLiteral{Token: token.Token{Type: token.NULL, Literal: "null"}}, nil
+
+	case *object.Array:
+		elements := []ast.Expression{}
+		for _, element := range obj.Elements {
+			node, err := FromObjectToASTExpression(element)
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, node)
+		}
+		return &ast.ArrayLiteral{Token: token.Token{Type: token.LBRACKET, Literal: "["}, Elements: elements}, nil
+
+	case *object.Hash:
+		hash := &ast.HashLiteral{
+			Token: token.Token{Type: token.LBRACE, Literal: "{"},
+			Pairs: make(map[ast.Expression]ast.Expression),
+			Keys:  []ast.Expression{},
+		}
+		for _, pair := range obj.Pairs {
+			key, err := FromObjectToASTExpression(pair.Key)
+			if err != nil {
+				return nil, err
+			}
+			value, err := FromObjectToASTExpression(pair.Value)
+			if err != nil {
+				return nil, err
+			}
+			hash.Pairs[key] = value
+			hash.Keys = append(hash.Keys, key)
+		}
+		return hash, nil
+
+	case *object.Quote:
+		return obj.Node, nil
+
+	case *object.Error:
+		return nil, obj
+
+	case *object.Function:
+		name := obj.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+		return nil, NewError("cannot unquote function %s, closures capture their environment", name)
+
 	default:
-		return nil
+		return nil, NewError("cannot unquote %s, it has no literal form", TypeOf(obj))
+	}
+}
+
+// FromObjectToASTExpression is FromObjectToASTNode for the elements of
+// literals, which must be expressions
+func FromObjectToASTExpression(obj object.Object) (ast.Expression, *object.Error) {
+	node, err := FromObjectToASTNode(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	expression, okay := node.(ast.Expression)
+	if !okay {
+		return nil, NewError("cannot unquote %s inside a literal, it is not an expression", node.String())
+	}
+
+	return expression, nil
+}
+
+// NodeType names the kind of node as ast_type reports it, e.g.
+// "CallExpression" for *ast.CallExpression
+func NodeType(node ast.Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+}
+
+// NodeName returns the name of an identifier, of the function called by
+// name or of the variable bound by a let statement
+func NodeName(node ast.Node) (string, bool) {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		return node.Value, true
+	case *ast.CallExpression:
+		return NodeName(node.Function)
+	case *ast.LetStatement:
+		if node.Name != nil {
+			return node.Name.Value, true
+		}
+	}
+	return "", false
+}
+
+// SubQuote quotes node, a part of the node of quote, so that the code
+// spliced into quote is still known as such
+func SubQuote(quote *object.Quote, node ast.Node) *object.Quote {
+	sub := &object.Quote{Node: node, Spliced: []ast.Node{}}
+
+	parts := map[ast.Node]bool{}
+	ast.Inspect(node, func(part ast.Node) bool {
+		parts[part] = true
+		return true
+	})
+
+	for _, spliced := range quote.Spliced {
+		if parts[spliced] {
+			sub.Spliced = append(sub.Spliced, spliced)
+			continue
+		}
+
+		inside := false
+		ast.Inspect(spliced, func(part ast.Node) bool {
+			inside = inside || part == node
+			return !inside
+		})
+		if inside {
+			return &object.Quote{Node: node, Spliced: []ast.Node{node}}
+		}
+	}
+
+	return sub
+}
+
+// MakeIdentifier returns an identifier node for name, which must be
+// lexed as an identifier
+func MakeIdentifier(name string) (*ast.Identifier, *object.Error) {
+	l := lexer.NewLexer(name)
+	tok := l.NextToken()
+
+	if tok.Type != token.IDENT || tok.Literal != name || l.NextToken().Type != token.EOF {
+		return nil, NewError("not a valid identifier: %q", name)
 	}
-}
\ No newline at end of file
+
+	return &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}, nil
+}
@@ -92,6 +92,32 @@ func TestUnquote(t *testing.T) {
             `quote(unquote(true == false))`,
             `false`,
         },
+        {
+            `quote(unquote(9223372036854775807 + 1) - 1)`,
+            `(9223372036854775808 - 1)`,
+        },        {
+            `quote(f(unquote(4 + 4), x))`,
+            `f(8, x)`,
+        },
+        {
+            `quote(fn(x) { unquote(true) })`,
+            `fn(x) true`,
+        },        {
+            `quote(unquote("mon" + "key"))`,
+            `monkey`,
+        },
+        {
+            `quote(unquote(if (false) { 1 }))`,
+            `null`,
+        },
+        {
+            `quote(unquote([1, [true], quote(x)]))`,
+            `[1, [true], x]`,
+        },
+        {
+            `quote(unquote({"a": 1, 2: [3]}))`,
+            `{a: 1, 2: [3]}`,
+        },
     }
 
     for _, tt := range tests {
@@ -110,4 +136,151 @@ func TestUnquote(t *testing.T) {
             t.Errorf("not equal, got=%q, want=%q", quote.Node.String(), tt.expected)
         }
     }
-}
\ No newline at end of file
+}
+
+func TestUnquoteRoundTrip(t *testing.T) {
+    tests := []string{
+        `"monkey"`,
+        `null`,
+        `[1, "two", [true, null]]`,
+        `{"a": 1, 2: "b", true: [3]}`,
+    }
+
+    for _, input := range tests {
+        expected := CheckEval(input).Inspect()
+        program := CheckParseProgram("let m = macro() { quote(unquote(" + input + ")) }; m()")
+        env := object.NewEnvironment()
+        DefineMacro(program, env)
+
+        expanded, err := ExpandMacro(program, env)
+        if err != nil {
+            t.Fatalf("expansion failed for %s: %s", input, err.Message)
+        }
+        evaluated := Eval(expanded, object.NewEnvironment())
+
+        if evaluated.Inspect() != expected {
+            t.Errorf("wrong value for %s, got=%q, want=%q", input, evaluated.Inspect(), expected)
+        }
+    }
+}
+
+func TestUnquoteErrors(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected string
+    }{
+        {
+            `quote(unquote(len))`,
+            "cannot unquote BUILTIN, it has no literal form",
+        },
+        {
+            `let f = fn(x) { x }; quote(unquote(f))`,
+            "cannot unquote function f, closures capture their environment",
+        },
+        {
+            `quote(unquote([1, fn() { 2 }]))`,
+            "cannot unquote function <anonymous>, closures capture their environment",
+        },
+        {
+            `quote(1 + unquote(missing))`,
+            "identifier not found: missing",
+        },
+    }
+
+    for _, tt := range tests {
+        evaluated := CheckEval(tt.input)
+
+        err, okay := evaluated.(*object.Error)
+        if !okay {
+            t.Errorf("expected *object.Error for %q, got=%T (%+v)", tt.input, evaluated, evaluated)
+            continue
+        }
+
+        if err.Message != tt.expected {
+            t.Errorf("wrong error message, got=%q, want=%q", err.Message, tt.expected)
+        }
+    }
+}
+
+func TestUnquoteSplice(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected string
+    }{
+        {
+            `quote([0, unquote_splice([1, 2]), 3])`,
+            `[0, 1, 2, 3]`,
+        },
+        {
+            `quote([unquote_splice([])])`,
+            `[]`,
+        },
+        {
+            `let args = [quote(a), quote(b + 1)]; quote(f(unquote_splice(args), c))`,
+            `f(a, (b + 1), c)`,
+        },
+        {
+            `quote(fn() { unquote_splice([quote(a), 1]); b })`,
+            `fn() a1b`,
+        },
+        {
+            `quote(if (x) { unquote_splice([quote(puts(1)), quote(puts(2))]) })`,
+            `if x puts(1)puts(2)`,
+        },
+        {
+            `quote([unquote_splice([1]), unquote(1 + 1), unquote_splice([3])])`,
+            `[1, 2, 3]`,
+        },
+    }
+
+    for _, tt := range tests {
+        evaluated := CheckEval(tt.input)
+
+        quote, okay := evaluated.(*object.Quote)
+        if !okay {
+            t.Fatalf("expected *object.Quote for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+        }
+
+        if quote.Node.String() != tt.expected {
+            t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), tt.expected)
+        }
+    }
+}
+
+func TestUnquoteSpliceErrors(t *testing.T) {
+    tests := []struct {
+        input    string
+        expected string
+    }{
+        {
+            `quote(1 + unquote_splice([1]))`,
+            "unquote_splice outside of an array, call arguments or block: unquote_splice([1])",
+        },
+        {
+            `quote([unquote_splice(3)])`,
+            "unquote_splice argument must be ARRAY, got INTEGER",
+        },
+        {
+            `quote([unquote_splice([1], [2])])`,
+            "wrong number of arguments to unquote_splice, got=2, want=1",
+        },
+        {
+            `quote([unquote_splice([len])])`,
+            "cannot unquote BUILTIN, it has no literal form",
+        },
+    }
+
+    for _, tt := range tests {
+        evaluated := CheckEval(tt.input)
+
+        err, okay := evaluated.(*object.Error)
+        if !okay {
+            t.Errorf("expected *object.Error for %q, got=%T (%+v)", tt.input, evaluated, evaluated)
+            continue
+        }
+
+        if err.Message != tt.expected {
+            t.Errorf("wrong error message, got=%q, want=%q", err.Message, tt.expected)
+        }
+    }
+}
@@ -1,15 +1,27 @@
 package lexer
 
-import "monkey/token"
+import (
+	"monkey/token"
+	"sort"
+	"strings"
+)
 
 type Lexer struct {
 	input string
 	position int
 	ReadPosition int
 	char byte
+	line int
+	LineStart int	// position of the first char of line
+	operators []string	// declared operators, longest first
+	declaring bool		// the next token is the operator of an infix statement
 }
 
 func (lexer *Lexer) ReadChar() {
+	if lexer.char == '\n' {
+		lexer.line += 1
+		lexer.LineStart = lexer.ReadPosition
+	}
 	if lexer.ReadPosition >= len(lexer.input) {
 		lexer.char = 0
 	} else {
@@ -28,7 +40,7 @@ func (lexer *Lexer) PeekChar() byte {
 }
 
 func NewLexer(input string) *Lexer {
-	lexer := &Lexer{input: input}
+	lexer := &Lexer{input: input, line: 1}
 	lexer.ReadChar()
 	return lexer
 }
@@ -49,13 +61,74 @@ func (lexer *Lexer) ReadIdentifier() string {
 	return lexer.input[position:lexer.position]
 }
 
+// IsOperatorChar reports whether char may be part of a declared operator
+func IsOperatorChar(char byte) bool {
+	return strings.IndexByte("+-*/<>=!&|^~?:.%@$#", char) >= 0
+}
+
+// DefineOperator makes the lexer read symbol as a single OPERATOR token,
+// preferring it over the built-in operators it starts with
+func (lexer *Lexer) DefineOperator(symbol string) {
+	for _, operator := range lexer.operators {
+		if operator == symbol {
+			return
+		}
+	}
+
+	lexer.operators = append(lexer.operators, symbol)
+	sort.SliceStable(lexer.operators, func(i, j int) bool {
+		return len(lexer.operators[i]) > len(lexer.operators[j])
+	})
+}
+
+// ReadOperator reads a run of operator chars, as the operator of an
+// infix statement
+func (lexer *Lexer) ReadOperator() string {
+	position := lexer.position
+	for IsOperatorChar(lexer.char) {
+		lexer.ReadChar()
+	}
+	return lexer.input[position:lexer.position]
+}
+
+// ReadDefinedOperator reads the longest declared operator at the current
+// position, if any
+func (lexer *Lexer) ReadDefinedOperator() (string, bool) {
+	for _, operator := range lexer.operators {
+		if strings.HasPrefix(lexer.input[lexer.position:], operator) {
+			for i := 0; i < len(operator); i++ {
+				lexer.ReadChar()
+			}
+			return operator, true
+		}
+	}
+	return "", false
+}
+
 func IsDigit(char byte) bool {
 	return '0' <= char && char <= '9'
 }
 
+func IsHexDigit(char byte) bool {
+	return IsDigit(char) || ('a' <= char && char <= 'f') || ('A' <= char && char <= 'F')
+}
+
+// ReadNumber reads decimal literals and 0x, 0b and 0o prefixed ones. Digits
+// may be grouped with _, whether the grouping is valid is left to the parser.
 func (lexer *Lexer) ReadNumber() string {
 	position := lexer.position
-	for IsDigit(lexer.char) {
+	IsNumberDigit := IsDigit
+
+	if lexer.char == '0' {
+		switch lexer.PeekChar() {
+		case 'x', 'X', 'b', 'B', 'o', 'O':
+			lexer.ReadChar()
+			lexer.ReadChar()
+			IsNumberDigit = IsHexDigit
+		}
+	}
+
+	for IsNumberDigit(lexer.char) || lexer.char == '_' {
 		lexer.ReadChar()
 	}
 	return lexer.input[position:lexer.position]
@@ -81,9 +154,34 @@ func (lexer *Lexer) ReadString() string {
 }
 
 func (lexer *Lexer) NextToken() token.Token {
+	lexer.SkipWhiteSpace()
+
+	line, column := lexer.line, lexer.position - lexer.LineStart + 1
+	t := lexer.ReadToken()
+	t.Line, t.Column = line, column
+
+	return t
+}
+
+func (lexer *Lexer) ReadToken() token.Token {
 	var t token.Token
 
-	lexer.SkipWhiteSpace()
+	declaring := lexer.declaring
+	lexer.declaring = false
+
+	if declaring && IsOperatorChar(lexer.char) {
+		t.Literal = lexer.ReadOperator()
+		t.Type = token.OPERATOR
+		return t
+	}
+
+	if IsOperatorChar(lexer.char) {
+		if operator, okay := lexer.ReadDefinedOperator(); okay {
+			t.Literal = operator
+			t.Type = token.OPERATOR
+			return t
+		}
+	}
 
 	switch lexer.char {
 	case '=':
@@ -91,6 +189,10 @@ func (lexer *Lexer) NextToken() token.Token {
 			t.Type = token.EQ
 			t.Literal = "=="
 			lexer.ReadChar()
+		} else if lexer.PeekChar() == '>' {
+			t.Type = token.ARROW
+			t.Literal = "=>"
+			lexer.ReadChar()
 		} else {
 			t = NewToken(token.ASSIGN, lexer.char)
 		}
@@ -105,7 +207,13 @@ func (lexer *Lexer) NextToken() token.Token {
 	case '+':
 		t = NewToken(token.PLUS, lexer.char)
 	case '-':
-		t = NewToken(token.MINUS, lexer.char)
+		if lexer.PeekChar() == '>' {
+			t.Type = token.THIN_ARROW
+			t.Literal = "->"
+			lexer.ReadChar()
+		} else {
+			t = NewToken(token.MINUS, lexer.char)
+		}
 	case '!':
 		if lexer.PeekChar() == '=' {
 			t.Type = token.NOT_EQ
@@ -119,9 +227,64 @@ func (lexer *Lexer) NextToken() token.Token {
 	case '/':
 		t = NewToken(token.SLASH, lexer.char)
 	case '<':
-		t = NewToken(token.LT, lexer.char)
+		if lexer.PeekChar() == '<' {
+			t.Type = token.SHIFT_LEFT
+			t.Literal = "<<"
+			lexer.ReadChar()
+		} else {
+			t = NewToken(token.LT, lexer.char)
+		}
 	case '>':
-		t = NewToken(token.GT, lexer.char)
+		if lexer.PeekChar() == '>' && lexer.ReadPosition + 1 < len(lexer.input) && lexer.input[lexer.ReadPosition + 1] == '>' {
+			t.Type = token.COMPOSE
+			t.Literal = ">>>"
+			lexer.ReadChar()
+			lexer.ReadChar()
+		} else if lexer.PeekChar() == '>' {
+			t.Type = token.SHIFT_RIGHT
+			t.Literal = ">>"
+			lexer.ReadChar()
+		} else {
+			t = NewToken(token.GT, lexer.char)
+		}
+	case '&':
+		t = NewToken(token.AMPERSAND, lexer.char)
+	case '|':
+		if lexer.PeekChar() == '>' {
+			t.Type = token.PIPELINE
+			t.Literal = "|>"
+			lexer.ReadChar()
+		} else {
+			t = NewToken(token.PIPE, lexer.char)
+		}
+	case '^':
+		t = NewToken(token.CARET, lexer.char)
+	case '~':
+		t = NewToken(token.TILDE, lexer.char)
+	case '?':
+		switch lexer.PeekChar() {
+		case '?':
+			t.Type = token.NULL_COALESCE
+			t.Literal = "??"
+			lexer.ReadChar()
+		case '[':
+			// always an optional index, so a ternary whose branch is an
+			// array needs a space: c ? [1] : [2]
+			t.Type = token.OPTIONAL_LBRACKET
+			t.Literal = "?["
+			lexer.ReadChar()
+		default:
+			t = NewToken(token.QUESTION, lexer.char)
+		}
+	case '.':
+		if lexer.PeekChar() == '.' && lexer.ReadPosition + 1 < len(lexer.input) && lexer.input[lexer.ReadPosition + 1] == '.' {
+			t.Type = token.ELLIPSIS
+			t.Literal = "..."
+			lexer.ReadChar()
+			lexer.ReadChar()
+		} else {
+			t = NewToken(token.ILLEGAL, lexer.char)
+		}
 	case '{':
 		t = NewToken(token.LBRACE, lexer.char)
 	case '}':
@@ -142,6 +305,7 @@ func (lexer *Lexer) NextToken() token.Token {
 		if IsLetter(lexer.char) {
 			t.Literal = lexer.ReadIdentifier()
 			t.Type = token.LookUpIdent(t.Literal)
+			lexer.declaring = t.Type == token.INFIX
 			return t
 		} else if IsDigit(lexer.char) {
 			t.Literal = lexer.ReadNumber()
@@ -34,7 +34,14 @@ func TestNextToken(t *testing.T) {
 	
 	{"foo": "bar"};
 	
-	macro(x, y) { x + y; };`
+	macro(x, y) { x + y; };
+
+	0xFF 0b1010 0o17 1_000_000;
+	a & b | c ^ ~d << 2 >> 1;
+	null ?? h?["key"];
+	match (x) { [a, ...b] if a => c ? 1 : 2 };
+	fn(x: int) -> bool { x - 1 };
+	xs |> f >>> g >> h | i;`
 
 	tests := [] struct {
 		ExpectedType	token.TokenType
@@ -140,6 +147,76 @@ func TestNextToken(t *testing.T) {
 		{ token.SEMICOLON, ";" },
 		{ token.RBRACE, "}" },
 		{ token.SEMICOLON, ";" },
+		{ token.INT, "0xFF" },
+		{ token.INT, "0b1010" },
+		{ token.INT, "0o17" },
+		{ token.INT, "1_000_000" },
+		{ token.SEMICOLON, ";" },
+		{ token.IDENT, "a" },
+		{ token.AMPERSAND, "&" },
+		{ token.IDENT, "b" },
+		{ token.PIPE, "|" },
+		{ token.IDENT, "c" },
+		{ token.CARET, "^" },
+		{ token.TILDE, "~" },
+		{ token.IDENT, "d" },
+		{ token.SHIFT_LEFT, "<<" },
+		{ token.INT, "2" },
+		{ token.SHIFT_RIGHT, ">>" },
+		{ token.INT, "1" },
+		{ token.SEMICOLON, ";" },
+		{ token.NULL, "null" },
+		{ token.NULL_COALESCE, "??" },
+		{ token.IDENT, "h" },
+		{ token.OPTIONAL_LBRACKET, "?[" },
+		{ token.STRING, "key" },
+		{ token.RBRACKET, "]" },
+		{ token.SEMICOLON, ";" },
+		{ token.MATCH, "match" },
+		{ token.LPAREN, "(" },
+		{ token.IDENT, "x" },
+		{ token.RPAREN, ")" },
+		{ token.LBRACE, "{" },
+		{ token.LBRACKET, "[" },
+		{ token.IDENT, "a" },
+		{ token.COMMA, "," },
+		{ token.ELLIPSIS, "..." },
+		{ token.IDENT, "b" },
+		{ token.RBRACKET, "]" },
+		{ token.IF, "if" },
+		{ token.IDENT, "a" },
+		{ token.ARROW, "=>" },
+		{ token.IDENT, "c" },
+		{ token.QUESTION, "?" },
+		{ token.INT, "1" },
+		{ token.COLON, ":" },
+		{ token.INT, "2" },
+		{ token.RBRACE, "}" },
+		{ token.SEMICOLON, ";" },
+		{ token.FUNCTION, "fn" },
+		{ token.LPAREN, "(" },
+		{ token.IDENT, "x" },
+		{ token.COLON, ":" },
+		{ token.IDENT, "int" },
+		{ token.RPAREN, ")" },
+		{ token.THIN_ARROW, "->" },
+		{ token.IDENT, "bool" },
+		{ token.LBRACE, "{" },
+		{ token.IDENT, "x" },
+		{ token.MINUS, "-" },
+		{ token.INT, "1" },
+		{ token.RBRACE, "}" },
+		{ token.SEMICOLON, ";" },
+		{ token.IDENT, "xs" },
+		{ token.PIPELINE, "|>" },
+		{ token.IDENT, "f" },
+		{ token.COMPOSE, ">>>" },
+		{ token.IDENT, "g" },
+		{ token.SHIFT_RIGHT, ">>" },
+		{ token.IDENT, "h" },
+		{ token.PIPE, "|" },
+		{ token.IDENT, "i" },
+		{ token.SEMICOLON, ";" },
 		{ token.EOF, "" },
 	}
 
@@ -156,4 +233,75 @@ func TestNextToken(t *testing.T) {
 			t.Fatalf("tests[%d] token literal wrong, expected=%q, got=%q", i, test.ExpectedLiteral, token.Literal)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x + \"a b\"\n\n!y"
+
+	tests := []struct {
+		ExpectedLiteral string
+		ExpectedLine int
+		ExpectedColumn int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"x", 2, 3},
+		{"+", 2, 5},
+		{"a b", 2, 7},
+		{"!", 4, 1},
+		{"y", 4, 2},
+		{"", 4, 3},
+	}
+
+	lexer := NewLexer(input)
+
+	for i, test := range tests {
+		token := lexer.NextToken()
+
+		if token.Literal != test.ExpectedLiteral {
+			t.Fatalf("tests[%d] token literal wrong, expected=%q, got=%q", i, test.ExpectedLiteral, token.Literal)
+		}
+
+		if token.Line != test.ExpectedLine || token.Column != test.ExpectedColumn {
+			t.Fatalf("tests[%d] token position wrong, expected=%d:%d, got=%d:%d", i, test.ExpectedLine, test.ExpectedColumn, token.Line, token.Column)
+		}
+	}
+}
+
+func TestDeclaredOperators(t *testing.T) {
+	input := "infix <|> 2; a <|> b |> c <| d"
+
+	tests := []struct {
+		ExpectedType token.TokenType
+		ExpectedLiteral string
+	}{
+		{token.INFIX, "infix"},
+		{token.OPERATOR, "<|>"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.OPERATOR, "<|>"},
+		{token.IDENT, "b"},
+		{token.OPERATOR, "|>"},
+		{token.IDENT, "c"},
+		{token.LT, "<"},
+		{token.PIPE, "|"},
+		{token.IDENT, "d"},
+		{token.EOF, ""},
+	}
+
+	lexer := NewLexer(input)
+	lexer.DefineOperator("|>")
+	lexer.DefineOperator("<|>")
+
+	for i, test := range tests {
+		token := lexer.NextToken()
+
+		if token.Type != test.ExpectedType || token.Literal != test.ExpectedLiteral {
+			t.Fatalf("tests[%d] wrong token, expected=%s %q, got=%s %q", i, test.ExpectedType, test.ExpectedLiteral, token.Type, token.Literal)
+		}
+	}
+}
@@ -0,0 +1,451 @@
+package lint
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/checker"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/resolver"
+	"monkey/token"
+	"sort"
+)
+
+// rule IDs, undefined and unused variables are reported by the resolver
+// and type errors by the checker
+const (
+	UNREACHABLE = "unreachable-code"
+	SHADOWED_BUILTIN = "shadowed-builtin"
+	WRONG_ARITY = "wrong-arity"
+	CONSTANT_CONDITION = "constant-condition"
+	MACRO_WITHOUT_QUOTE = "macro-without-quote"
+	UNDEFINED = resolver.UNDEFINED
+	UNUSED = resolver.UNUSED
+	TYPE_ERROR = "type-error"
+)
+
+var Rules = []string{
+	UNREACHABLE,
+	SHADOWED_BUILTIN,
+	WRONG_ARITY,
+	CONSTANT_CONDITION,
+	MACRO_WITHOUT_QUOTE,
+	UNDEFINED,
+	UNUSED,
+	TYPE_ERROR,
+}
+
+type Diagnostic struct {
+	Rule string
+	Token token.Token
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", d.Token.Line, d.Token.Column, d.Rule, d.Message)
+}
+
+// Linter reports mistakes the parser accepts. Scopes map the names bound so
+// far to their function literal, or nil when the value is not a function.
+type Linter struct {
+	builtins map[string]bool
+	disabled map[string]bool
+	scopes []map[string]*ast.FunctionLiteral
+	diagnostics []Diagnostic
+}
+
+func NewLinter() *Linter {
+	l := &Linter{builtins: make(map[string]bool), disabled: make(map[string]bool)}
+
+	for _, name := range evaluator.BuiltinNames() {
+		l.builtins[name] = true
+	}
+
+	return l
+}
+
+// Disable suppresses all diagnostics of rule
+func (l *Linter) Disable(rule string) error {
+	for _, known := range Rules {
+		if rule == known {
+			l.disabled[rule] = true
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown lint rule: %s", rule)
+}
+
+// Lint returns the diagnostics for program sorted by position.
+// It resolves the program, so it should not be evaluated afterwards.
+func (l *Linter) Lint(program *ast.Program) []Diagnostic {
+	l.diagnostics = []Diagnostic{}
+	l.scopes = []map[string]*ast.FunctionLiteral{{}}
+
+	l.LintNode(program)
+
+	for _, err := range checker.NewChecker().Check(program) {
+		l.Report(TYPE_ERROR, err.Token, "%s", err.Message)
+	}
+
+	r := resolver.NewResolver(nil, evaluator.BuiltinNames())
+	r.ReportUnusedGlobals = true
+	for _, d := range r.Resolve(program) {
+		l.Report(d.Kind, d.Token, "%s", d.Message)
+	}
+
+	sort.SliceStable(l.diagnostics, func(i, j int) bool {
+		a, b := l.diagnostics[i].Token, l.diagnostics[j].Token
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+
+	return l.diagnostics
+}
+
+func (l *Linter) LintNode(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.Program:
+		l.LintStatements(node.Statements)
+
+	case *ast.BlockStatement:
+		l.LintStatements(node.Statements)
+
+	case *ast.ExpressionStatement:
+		l.LintNode(node.Expression)
+
+	case *ast.ReturnStatement:
+		l.LintNode(node.Value)
+
+	case *ast.LetStatement:
+		if fl, okay := node.Value.(*ast.FunctionLiteral); okay && node.Pattern == nil {
+			// declared first, the function can call itself
+			l.Declare(node.Name, fl)
+			l.LintNode(fl)
+		} else {
+			l.LintNode(node.Value)
+			l.DeclarePattern(node.Pattern, node.Name)
+		}
+
+	case *ast.InfixDeclaration:
+		if fl, okay := node.Function.(*ast.FunctionLiteral); okay {
+			l.Declare(node.Name, fl)
+		}
+		l.LintNode(node.Function)
+
+	case *ast.PrefixExpression:
+		l.LintNode(node.Operand)
+
+	case *ast.InfixExpression:
+		if node.Operator == "|>" && node.Function == nil {
+			// linted as the call it makes, so that arity counts the piped value
+			l.LintNode(checker.PipelineCall(node))
+			break
+		}
+		l.LintNode(node.OperandLeft)
+		l.LintNode(node.OperandRight)
+		if node.Function != nil {
+			// a declared operator calls its function with both operands
+			l.CheckArity(&ast.CallExpression{
+				Token:     node.Token,
+				Function:  node.Function,
+				Arguments: []ast.Expression{node.OperandLeft, node.OperandRight},
+			})
+		}
+
+	case *ast.IfExpression:
+		l.CheckCondition(node.Token, node.Condition)
+		l.LintNode(node.Condition)
+		l.LintNode(node.Consequence)
+		if node.Alternative != nil {
+			l.LintNode(node.Alternative)
+		}
+
+	case *ast.ConditionalExpression:
+		l.CheckCondition(node.Token, node.Condition)
+		l.LintNode(node.Condition)
+		l.LintNode(node.Consequence)
+		l.LintNode(node.Alternative)
+
+	case *ast.MatchExpression:
+		l.LintNode(node.Subject)
+		for _, arm := range node.Arms {
+			l.PushScope()
+			l.DeclarePattern(arm.Pattern, nil)
+			if arm.Guard != nil {
+				l.LintNode(arm.Guard)
+			}
+			l.LintNode(arm.Body)
+			l.PopScope()
+		}
+
+	case *ast.IndexExpression:
+		l.LintNode(node.Array)
+		l.LintNode(node.Index)
+
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			l.LintNode(element)
+		}
+
+	case *ast.HashLiteral:
+		for _, key := range node.Keys {
+			l.LintNode(key)
+			l.LintNode(node.Pairs[key])
+		}
+
+	case *ast.SpreadExpression:
+		l.LintNode(node.Value)
+
+	case *ast.CallExpression:
+		// quoted code is data until it is expanded
+		if node.Function.TokenLiteral() == "quote" {
+			return
+		}
+		l.CheckArity(node)
+		l.LintNode(node.Function)
+		for _, arg := range node.Arguments {
+			l.LintNode(arg)
+		}
+
+	case *ast.FunctionLiteral:
+		l.PushScope()
+		for _, param := range node.Parameters {
+			switch param := param.(type) {
+			case *ast.DefaultParameter:
+				l.LintNode(param.Default)
+				l.DeclarePattern(param.Pattern, nil)
+			case *ast.SpreadExpression:
+				l.DeclarePattern(param.Value, nil)
+			default:
+				l.DeclarePattern(param, nil)
+			}
+		}
+		l.LintNode(node.Body)
+		l.PopScope()
+
+	case *ast.MacroLiteral:
+		l.CheckMacro(node)
+		l.PushScope()
+		for _, param := range node.Parameters {
+			l.Declare(param, nil)
+		}
+		l.LintNode(node.Body)
+		l.PopScope()
+	}
+}
+
+// LintStatements reports the first statement following a return
+func (l *Linter) LintStatements(statements []ast.Statement) {
+	for i, stmt := range statements {
+		if _, okay := stmt.(*ast.ReturnStatement); okay && i + 1 < len(statements) {
+			next := statements[i + 1]
+			l.Report(UNREACHABLE, StatementToken(next), "unreachable code after return: %s", next.String())
+			break
+		}
+	}
+
+	for _, stmt := range statements {
+		l.LintNode(stmt)
+	}
+}
+
+// StatementToken returns the first token of a statement
+func StatementToken(stmt ast.Statement) token.Token {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		return stmt.Token
+	case *ast.ReturnStatement:
+		return stmt.Token
+	case *ast.InfixDeclaration:
+		return stmt.Token
+	case *ast.ExpressionStatement:
+		return stmt.Token
+	}
+	return token.Token{}
+}
+
+func (l *Linter) PushScope() {
+	l.scopes = append(l.scopes, map[string]*ast.FunctionLiteral{})
+}
+
+func (l *Linter) PopScope() {
+	l.scopes = l.scopes[:len(l.scopes) - 1]
+}
+
+func (l *Linter) Declare(identifier *ast.Identifier, fl *ast.FunctionLiteral) {
+	if l.builtins[identifier.Value] {
+		l.Report(SHADOWED_BUILTIN, identifier.Token, "%s shadows the builtin function %s", identifier.Value, identifier.Value)
+	}
+	l.scopes[len(l.scopes) - 1][identifier.Value] = fl
+}
+
+// DeclarePattern declares the identifiers of pattern, or name when pattern is nil
+func (l *Linter) DeclarePattern(pattern ast.Expression, name *ast.Identifier) {
+	if pattern == nil {
+		l.Declare(name, nil)
+		return
+	}
+
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			l.Declare(pattern, nil)
+		}
+	case *ast.ArrayLiteral:
+		for _, element := range pattern.Elements {
+			if spread, okay := element.(*ast.SpreadExpression); okay {
+				element = spread.Value
+			}
+			l.DeclarePattern(element, nil)
+		}
+	case *ast.HashLiteral:
+		for _, key := range pattern.Keys {
+			l.DeclarePattern(pattern.Pairs[key], nil)
+		}
+	}
+}
+
+func (l *Linter) Lookup(name string) *ast.FunctionLiteral {
+	for i := len(l.scopes) - 1; i >= 0; i -= 1 {
+		if fl, okay := l.scopes[i][name]; okay {
+			return fl
+		}
+	}
+	return nil
+}
+
+// CheckArity checks calls to functions bound by let in an enclosing scope,
+// calls spreading their arguments are skipped
+func (l *Linter) CheckArity(call *ast.CallExpression) {
+	identifier, okay := call.Function.(*ast.Identifier)
+	if !okay {
+		return
+	}
+
+	fl := l.Lookup(identifier.Value)
+	if fl == nil {
+		return
+	}
+
+	for _, arg := range call.Arguments {
+		if _, okay := arg.(*ast.SpreadExpression); okay {
+			return
+		}
+	}
+
+	fn := &object.Function{Name: identifier.Value, Parameters: fl.Parameters}
+	if err := evaluator.CheckArity(fn, len(call.Arguments)); err != nil {
+		l.Report(WRONG_ARITY, identifier.Token, "%s", err.Message)
+	}
+}
+
+// CheckCondition reports conditions built only from literals,
+// reported at tok since expressions do not expose their first token
+func (l *Linter) CheckCondition(tok token.Token, condition ast.Expression) {
+	if IsConstant(condition) {
+		l.Report(CONSTANT_CONDITION, tok, "condition is always the same: %s", condition.String())
+	}
+}
+
+func IsConstant(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.IntegerLiteral, *ast.Boolean, *ast.StringLiteral, *ast.NullLiteral:
+		return true
+	case *ast.ArrayLiteral, *ast.HashLiteral, *ast.FunctionLiteral:
+		// always truthy, whatever they contain
+		return true
+	case *ast.PrefixExpression:
+		return IsConstant(expr.Operand)
+	case *ast.InfixExpression:
+		return expr.Function == nil && expr.Operator != "|>" && IsConstant(expr.OperandLeft) && IsConstant(expr.OperandRight)
+	}
+	return false
+}
+
+// CheckMacro reports macros that can evaluate to something other than a
+// quote. Results that may hold a quote at run time, like identifiers or
+// calls, are given the benefit of the doubt.
+func (l *Linter) CheckMacro(ml *ast.MacroLiteral) {
+	for _, result := range MacroResults(ml.Body) {
+		if result == nil || !MayBeQuote(result) {
+			l.Report(MACRO_WITHOUT_QUOTE, ml.Token, "macro does not always return a quote")
+			return
+		}
+	}
+}
+
+// MacroResults collects the expressions a block can evaluate to,
+// nil stands for a block or statement producing no value
+func MacroResults(block *ast.BlockStatement) []ast.Expression {
+	results := []ast.Expression{}
+
+	if block == nil || len(block.Statements) == 0 {
+		return append(results, nil)
+	}
+
+	last := len(block.Statements) - 1
+	for _, stmt := range block.Statements[:last] {
+		results = append(results, CollectReturns(stmt)...)
+	}
+
+	switch stmt := block.Statements[last].(type) {
+	case *ast.ReturnStatement:
+		results = append(results, stmt.Value)
+	case *ast.ExpressionStatement:
+		if ie, okay := stmt.Expression.(*ast.IfExpression); okay {
+			results = append(results, MacroResults(ie.Consequence)...)
+			results = append(results, MacroResults(ie.Alternative)...)
+		} else {
+			results = append(results, stmt.Expression)
+		}
+	default:
+		results = append(results, nil)
+	}
+
+	return results
+}
+
+// CollectReturns finds the values returned from within the if expressions
+// of a statement
+func CollectReturns(stmt ast.Statement) []ast.Expression {
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStatement:
+		return []ast.Expression{stmt.Value}
+	case *ast.ExpressionStatement:
+		ie, okay := stmt.Expression.(*ast.IfExpression)
+		if !okay {
+			return nil
+		}
+		returns := []ast.Expression{}
+		for _, block := range []*ast.BlockStatement{ie.Consequence, ie.Alternative} {
+			if block == nil {
+				continue
+			}
+			for _, inner := range block.Statements {
+				returns = append(returns, CollectReturns(inner)...)
+			}
+		}
+		return returns
+	}
+	return nil
+}
+
+func MayBeQuote(expr ast.Expression) bool {
+	switch expr := expr.(type) {
+	case *ast.CallExpression:
+		return true
+	case *ast.Identifier, *ast.IndexExpression, *ast.MatchExpression:
+		return true
+	case *ast.ConditionalExpression:
+		return MayBeQuote(expr.Consequence) || MayBeQuote(expr.Alternative)
+	case *ast.InfixExpression:
+		return expr.Operator == "??" || expr.Operator == "|>" || expr.Function != nil
+	}
+	return false
+}
+
+func (l *Linter) Report(rule string, tok token.Token, format string, a ...interface{}) {
+	if l.disabled[rule] {
+		return
+	}
+	l.diagnostics = append(l.diagnostics, Diagnostic{Rule: rule, Token: tok, Message: fmt.Sprintf(format, a...)})
+}
@@ -0,0 +1,89 @@
+package lint
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func CheckLint(t *testing.T, input string, disabled ...string) []Diagnostic {
+	p := parser.NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+
+	if len(p.GetErrors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.GetErrors())
+	}
+
+	linter := NewLinter()
+	for _, rule := range disabled {
+		if err := linter.Disable(rule); err != nil {
+			t.Fatalf("%v", err)
+		}
+	}
+
+	return linter.Lint(program)
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		input string
+		expected []string
+	}{
+		{ `let x = 1; puts(x);`, []string{} },
+		{ "let f = fn() {\n  return 1;\n  puts(2);\n};\nf();", []string{"3:3: unreachable-code: unreachable code after return: puts(2)"} },
+		{ `let len = fn(x) { 0 }; len(1);`, []string{"1:5: shadowed-builtin: len shadows the builtin function len"} },
+		{ `let f = fn(first) { first }; f(1);`, []string{"1:12: shadowed-builtin: first shadows the builtin function first"} },
+		{ `let f = fn(a, b) { a + b }; f(1);`, []string{"1:29: wrong-arity: wrong number of arguments to f, got=1, want=2"} },
+		{ `let f = fn(a, b = 1) { a + b }; f(1); f(1, 2); f(...[1, 2, 3]);`, []string{} },
+		{ `let f = fn(a) { a }; let g = fn(f) { f(1, 2) }; g(f);`, []string{} },
+		{ `let f = fn(n) { f(n, n) }; f(1);`, []string{"1:17: wrong-arity: wrong number of arguments to f, got=2, want=1"} },
+		{ `let f = fn(a, b) { a + b }; puts(1 |> f(2));`, []string{} },
+		{ `let f = fn(a, b) { a + b }; puts(1 |> f);`, []string{"1:39: wrong-arity: wrong number of arguments to f, got=1, want=2"} },
+		{ `let f = fn(a) { a }; puts(1 |> f(2));`, []string{"1:32: wrong-arity: wrong number of arguments to f, got=2, want=1"} },
+		{ `infix <> 3 = fn(a, b) { a }; puts(1 <> 2);`, []string{} },
+		{ `infix <> 3 = fn(a) { a }; puts(1 <> 2);`, []string{"1:34: wrong-arity: wrong number of arguments to infix <>, got=2, want=1"} },
+		{ `infix <> 3 = fn(a, b) { a }; if (1 <> 2) { puts(1) }`, []string{} },
+		{ `if (1 < 2) { puts(1) }`, []string{"1:1: constant-condition: condition is always the same: (1 < 2)"} },
+		{ `let x = 1; if (x < 2) { puts(1) }`, []string{} },
+		{ `let x = 1; puts(!true ? x : 0)`, []string{"1:23: constant-condition: condition is always the same: (!true)"} },
+		{ `let m = macro(a) { 1 }; m(2);`, []string{"1:9: macro-without-quote: macro does not always return a quote"} },
+		{ `let m = macro(a) { if (a) { quote(1) } }; m(2);`, []string{"1:9: macro-without-quote: macro does not always return a quote"} },
+		{ `let m = macro(a) { if (a) { return "no" }; quote(1) }; m(2);`, []string{"1:9: macro-without-quote: macro does not always return a quote"} },
+		{ `let m = macro(a) { let q = quote(unquote(a) + 1); q }; m(2);`, []string{} },
+		{ "let x = 1;\nlet y = 2;\nputs(y)", []string{"1:5: unused-variable: unused variable: x"} },
+		{ `puts(z)`, []string{"1:6: undefined-variable: undefined variable: z"} },
+		{ `let x: int = 5; puts(x + "a")`, []string{"1:24: type-error: type mismatch: int + string"} },
+	}
+
+	for _, tt := range tests {
+		diagnostics := CheckLint(t, tt.input)
+
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q, got=%v, want=%v", tt.input, diagnostics, tt.expected)
+			continue
+		}
+
+		for i, d := range diagnostics {
+			if d.String() != tt.expected[i] {
+				t.Errorf("wrong diagnostic for %q, got=%q, want=%q", tt.input, d.String(), tt.expected[i])
+			}
+		}
+	}
+}
+
+func TestDisable(t *testing.T) {
+	input := `let len = fn(a) { return a; a }; let unused = 1;`
+
+	if diagnostics := CheckLint(t, input); len(diagnostics) != 4 {
+		t.Fatalf("expected 4 diagnostics, got=%v", diagnostics)
+	}
+
+	diagnostics := CheckLint(t, input, SHADOWED_BUILTIN, UNUSED)
+	if len(diagnostics) != 1 || diagnostics[0].Rule != UNREACHABLE {
+		t.Fatalf("expected only %s, got=%v", UNREACHABLE, diagnostics)
+	}
+
+	if err := NewLinter().Disable("no-such-rule"); err == nil || err.Error() != "unknown lint rule: no-such-rule" {
+		t.Errorf("wrong error for an unknown rule, got=%v", err)
+	}
+}
@@ -1,13 +1,28 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io/ioutil"
+	"monkey/lexer"
+	"monkey/lint"
+	"monkey/object"
+	"monkey/parser"
 	"monkey/repl"
 	"os"
 	"os/user"
+	"strings"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(Lint(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "expand" {
+		os.Exit(Expand(os.Args[2:]))
+	}
+
 	user, err := user.Current()
 
 	if err != nil {
@@ -18,4 +33,99 @@ func main() {
 	fmt.Printf("Feel free to type in commands.\n")
 
 	repl.StartConsole(os.Stdin, os.Stdout)
-}
\ No newline at end of file
+}
+
+// Lint implements `monkey lint [-disable rule,...] file...` and returns the
+// exit status: 0 when the files are clean, 1 when any diagnostic is reported
+func Lint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	disable := flags.String("disable", "", "comma separated rule IDs to suppress: " + strings.Join(lint.Rules, ", "))
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: monkey lint [-disable rule,...] file...")
+		return 2
+	}
+
+	status := 0
+
+	for _, filename := range flags.Args() {
+		source, err := ioutil.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+
+		p := parser.NewParser(lexer.NewLexer(string(source)))
+		program := p.ParseProgram()
+
+		if len(p.GetErrors()) != 0 {
+			for _, msg := range p.GetErrors() {
+				fmt.Printf("%s: parser error: %s\n", filename, msg)
+			}
+			status = 1
+			continue
+		}
+
+		linter := lint.NewLinter()
+		if *disable != "" {
+			for _, rule := range strings.Split(*disable, ",") {
+				if err := linter.Disable(strings.TrimSpace(rule)); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					return 2
+				}
+			}
+		}
+
+		for _, d := range linter.Lint(program) {
+			fmt.Printf("%s:%s\n", filename, d.String())
+			status = 1
+		}
+	}
+
+	return status
+}
+
+// Expand implements `monkey expand [-steps] file...`, which prints each file
+// after macro expansion. It returns 1 when a file does not parse or expand.
+func Expand(args []string) int {
+	flags := flag.NewFlagSet("expand", flag.ExitOnError)
+	steps := flags.Bool("steps", false, "show each macro call expanded and the macros that produced it")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: monkey expand [-steps] file...")
+		return 2
+	}
+
+	status := 0
+
+	for _, filename := range flags.Args() {
+		source, err := ioutil.ReadFile(filename)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+
+		p := parser.NewParser(lexer.NewLexer(string(source)))
+		program := p.ParseProgram()
+
+		if len(p.GetErrors()) != 0 {
+			for _, msg := range p.GetErrors() {
+				fmt.Printf("%s: parser error: %s\n", filename, msg)
+			}
+			status = 1
+			continue
+		}
+
+		if flags.NArg() > 1 {
+			fmt.Printf("// %s\n", filename)
+		}
+
+		if !repl.PrintExpansion(os.Stdout, program, object.NewEnvironment(), *steps) {
+			status = 1
+		}
+	}
+
+	return status
+}
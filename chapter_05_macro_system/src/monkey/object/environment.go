@@ -1,13 +1,17 @@
 package object
 
+// Environment keeps its bindings in slots. Names map to slots for lookups by
+// name, while code processed by the resolver addresses slots directly.
 type Environment struct {
-	store map[string]Object
+	slots []Object
+	names []string
+	index map[string]int
+	constants map[string]bool
 	outer *Environment
 }
 
 func NewEnvironment() *Environment {
-	env := make(map[string]Object)
-	return &Environment{store: env, outer: nil}
+	return &Environment{index: make(map[string]int), constants: make(map[string]bool), outer: nil}
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
@@ -17,14 +21,81 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, okay := e.store[name]
-	if !okay && e.outer != nil {
-		obj, okay = e.outer.Get(name)
+	if slot, okay := e.index[name]; okay {
+		return e.slots[slot], true
 	}
-	return obj, okay
+	if e.outer != nil {
+		return e.outer.Get(name)
+	}
+	return nil, false
 }
 
 func (e *Environment) Set(name string, obj Object) Object {
-	e.store[name] = obj
+	if slot, okay := e.index[name]; okay {
+		e.slots[slot] = obj
+		return obj
+	}
+
+	e.index[name] = len(e.slots)
+	e.slots = append(e.slots, obj)
+	e.names = append(e.names, name)
+
 	return obj
-}
\ No newline at end of file
+}
+
+// GetSlot looks up a binding placed by the resolver, depth scopes out. It
+// fails when the slot does not hold name yet, callers then fall back to Get.
+// The name is checked because a REPL line that fails leaves the slots of
+// its later bindings empty, and the next lines reuse them for other names.
+func (e *Environment) GetSlot(depth int, slot int, name string) (Object, bool) {
+	env := e
+	for ; depth > 0 && env != nil; depth -= 1 {
+		env = env.outer
+	}
+
+	if env == nil || slot >= len(env.names) || env.names[slot] != name {
+		return nil, false
+	}
+
+	return env.slots[slot], true
+}
+
+// SetSlot binds name in the slot chosen by the resolver. If the name already
+// lives elsewhere or the slot is taken by another name it behaves like Set.
+func (e *Environment) SetSlot(slot int, name string, obj Object) Object {
+	if current, okay := e.index[name]; okay && current != slot {
+		return e.Set(name, obj)
+	}
+
+	for len(e.slots) <= slot {
+		e.slots = append(e.slots, nil)
+		e.names = append(e.names, "")
+	}
+
+	if e.names[slot] != "" && e.names[slot] != name {
+		return e.Set(name, obj)
+	}
+
+	e.slots[slot] = obj
+	e.names[slot] = name
+	e.index[name] = slot
+
+	return obj
+}
+
+// Names returns the bound names indexed by slot, unused slots are empty
+func (e *Environment) Names() []string {
+	names := make([]string, len(e.names))
+	copy(names, e.names)
+	return names
+}
+
+// MarkConstant forbids binding name again in this scope,
+// inner scopes can still shadow it
+func (e *Environment) MarkConstant(name string) {
+	e.constants[name] = true
+}
+
+func (e *Environment) IsConstant(name string) bool {
+	return e.constants[name]
+}
@@ -0,0 +1,50 @@
+package object
+
+// Equal reports whether two objects are structurally equal. Arrays and hashes
+// are compared element by element, functions and other reference-like objects
+// by identity. Objects of different types are never equal.
+func Equal(a, b Object) bool {
+	if a == b {
+		return true
+	}
+
+	if a == nil || b == nil || a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Cmp(b.(*Integer)) == 0
+	case *Boolean:
+		return a.Value == b.(*Boolean).Value
+	case *String:
+		return a.Value == b.(*String).Value
+	case *Null:
+		return true
+	case *Array:
+		other := b.(*Array)
+		if len(a.Elements) != len(other.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !Equal(a.Elements[i], other.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		other := b.(*Hash)
+		if len(a.Pairs) != len(other.Pairs) {
+			return false
+		}
+		for _, pair := range a.Pairs {
+			OtherPair, okay := other.Get(pair.Key)
+			if !okay || !Equal(pair.Value, OtherPair.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
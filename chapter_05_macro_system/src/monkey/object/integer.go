@@ -0,0 +1,52 @@
+package object
+
+import "math/big"
+
+// NewBigInteger returns an Integer for value, keeping it on the int64
+// representation whenever it fits
+func NewBigInteger(value *big.Int) *Integer {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &Integer{Big: value}
+}
+
+func (i *Integer) IsBig() bool {
+	return i.Big != nil
+}
+
+// BigInt returns the value as a big.Int, which the caller is free to modify
+func (i *Integer) BigInt() *big.Int {
+	if i.Big != nil {
+		return new(big.Int).Set(i.Big)
+	}
+	return big.NewInt(i.Value)
+}
+
+func (i *Integer) Cmp(other *Integer) int {
+	if i.Big == nil && other.Big == nil {
+		switch {
+		case i.Value < other.Value:
+			return -1
+		case i.Value > other.Value:
+			return 1
+		default:
+			return 0
+		}
+	}
+	return i.BigInt().Cmp(other.BigInt())
+}
+
+func (i *Integer) Sign() int {
+	if i.Big != nil {
+		return i.Big.Sign()
+	}
+	switch {
+	case i.Value < 0:
+		return -1
+	case i.Value > 0:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -2,8 +2,11 @@ package object
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
+	"hash"
 	"hash/fnv"
+	"math/big"
 	"monkey/ast"
 	"strings"
 )
@@ -30,12 +33,20 @@ type Object interface {
 	Inspect() string
 }
 
+// Integer holds its value in Value while it fits in an int64. Results that
+// overflow are promoted to Big, see NewBigInteger.
 type Integer struct {
 	Value int64
+	Big *big.Int
 }
 
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
-func (i *Integer) Inspect() string { return fmt.Sprintf("%d", i.Value) }
+func (i *Integer) Inspect() string {
+	if i.Big != nil {
+		return i.Big.String()
+	}
+	return fmt.Sprintf("%d", i.Value)
+}
 
 type Boolean struct {
 	Value bool
@@ -64,7 +75,8 @@ func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string { return "ERROR: " + e.Message }
 
 type Function struct {
-	Parameters []*ast.Identifier
+	Name string
+	Parameters []ast.Expression
 	Body *ast.BlockStatement
 	Env *Environment
 }
@@ -95,7 +107,10 @@ type String struct {
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string { return s.Value }
 
-type BuiltinFunction func(args ...Object) Object
+// CallFunction lets builtins call back into Monkey functions through the evaluator
+type CallFunction func(fn Object, args []Object) Object
+
+type BuiltinFunction func(call CallFunction, args ...Object) Object
 
 type Builtin struct {
 	Func BuiltinFunction
@@ -104,8 +119,11 @@ type Builtin struct {
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string { return "builtin function" }
 
+// Array has no method changing it in place, the builtins build new arrays.
+// Frozen is set by freeze and reported by is_frozen.
 type Array struct {
 	Elements []Object
+	Frozen bool
 }
 
 func (a *Array) Type() ObjectType { return ARRAY_OBJ }
@@ -142,6 +160,11 @@ func (b *Boolean) HashKey() HashKey {
 }
 
 func (i *Integer) HashKey() HashKey {
+	if i.Big != nil {
+		hash := fnv.New64a()
+		hash.Write([]byte(i.Big.String()))
+		return HashKey{Type: i.Type(), Value: hash.Sum64()}
+	}
 	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
 }
 
@@ -151,13 +174,139 @@ func (s *String) HashKey() HashKey {
 	return HashKey{Type: s.Type(), Value: hash.Sum64()}
 }
 
+func (a *Array) HashKey() HashKey {
+	hash := fnv.New64a()
+
+	for _, element := range a.Elements {
+		if hashable, okay := element.(Hashable); okay {
+			WriteHashKey(hash, hashable.HashKey())
+		}
+	}
+
+	return HashKey{Type: a.Type(), Value: hash.Sum64()}
+}
+
+// HashKey of a hash does not depend on the order of its pairs,
+// so that hashes which are Equal also share the same key
+func (h *Hash) HashKey() HashKey {
+	var value uint64
+
+	for _, pair := range h.Pairs {
+		hash := fnv.New64a()
+		WriteHashKey(hash, pair.Key.(Hashable).HashKey())
+		if hashable, okay := pair.Value.(Hashable); okay {
+			WriteHashKey(hash, hashable.HashKey())
+		}
+		value += hash.Sum64()
+	}
+
+	return HashKey{Type: h.Type(), Value: value}
+}
+
+func WriteHashKey(digest hash.Hash64, key HashKey) {
+	var buffer [8]byte
+	binary.LittleEndian.PutUint64(buffer[:], key.Value)
+	digest.Write([]byte(key.Type))
+	digest.Write(buffer[:])
+}
+
 type HashPair struct {
 	Key   Object
 	Value Object
 }
 
+// Hash keeps its pairs in insertion order. The index maps a HashKey to the
+// positions of all pairs sharing it, so keys whose hashes collide are told
+// apart by comparing the keys themselves.
 type Hash struct {
-	Pairs map[HashKey] HashPair
+	Pairs []HashPair
+	index map[HashKey] []int
+	Frozen bool	// Set and Delete refuse to change a frozen hash
+}
+
+func FrozenError(obj Object) *Error {
+	return &Error{Message: fmt.Sprintf("cannot modify frozen %s: %s", obj.Type(), obj.Inspect())}
+}
+
+func NewHash() *Hash {
+	return &Hash{index: make(map[HashKey] []int)}
+}
+
+func (h *Hash) find(key Object) int {
+	hashable, okay := key.(Hashable)
+	if !okay {
+		return -1
+	}
+
+	for _, i := range h.index[hashable.HashKey()] {
+		if Equal(h.Pairs[i].Key, key) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Set stores the pair, keeping the position of keys that are already present.
+// The key of the pair must be hashable.
+func (h *Hash) Set(pair HashPair) *Error {
+	if h.Frozen {
+		return FrozenError(h)
+	}
+
+	if i := h.find(pair.Key); i >= 0 {
+		h.Pairs[i].Value = pair.Value
+		return nil
+	}
+
+	if h.index == nil {
+		h.index = make(map[HashKey] []int)
+	}
+
+	key := pair.Key.(Hashable).HashKey()
+	h.index[key] = append(h.index[key], len(h.Pairs))
+	h.Pairs = append(h.Pairs, pair)
+	return nil
+}
+
+func (h *Hash) Get(key Object) (HashPair, bool) {
+	if i := h.find(key); i >= 0 {
+		return h.Pairs[i], true
+	}
+	return HashPair{}, false
+}
+
+func (h *Hash) Delete(key Object) *Error {
+	if h.Frozen {
+		return FrozenError(h)
+	}
+
+	i := h.find(key)
+	if i < 0 {
+		return nil
+	}
+
+	pairs := h.Pairs
+	h.Pairs = nil
+	h.index = make(map[HashKey] []int)
+
+	for j, pair := range pairs {
+		if j != i {
+			h.Set(pair)
+		}
+	}
+	return nil
+}
+
+// Copy returns a hash with the same pairs, which is not frozen
+func (h *Hash) Copy() *Hash {
+	hash := NewHash()
+
+	for _, pair := range h.Pairs {
+		hash.Set(pair)
+	}
+
+	return hash
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
@@ -181,8 +330,36 @@ type Hashable interface {
 	HashKey() HashKey
 }
 
+// IsHashable reports whether obj can be used as a hash key. Arrays and hashes
+// are only hashable when everything they contain is.
+func IsHashable(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Array:
+		for _, element := range obj.Elements {
+			if !IsHashable(element) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		for _, pair := range obj.Pairs {
+			if !IsHashable(pair.Value) {
+				return false
+			}
+		}
+		return true
+	case Hashable:
+		return true
+	default:
+		return false
+	}
+}
+
+// Quote holds unevaluated code. Spliced lists the subtrees inserted by
+// unquote, which macro hygiene leaves untouched.
 type Quote struct {
     Node ast.Node
+    Spliced []ast.Node
 }
 
 func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
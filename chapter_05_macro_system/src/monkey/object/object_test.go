@@ -57,4 +57,138 @@ func TestIntegerHashKey(t *testing.T) {
 	if one1.HashKey() == two1.HashKey() {
 		t.Errorf("integers with twoerent content have same hash keys")
 	}
-}
\ No newline at end of file
+}
+
+func TestHashInsertionOrder(t *testing.T) {
+	hash := NewHash()
+
+	keys := []*String{{Value: "c"}, {Value: "a"}, {Value: "b"}}
+	for i, key := range keys {
+		hash.Set(HashPair{Key: key, Value: &Integer{Value: int64(i)}})
+	}
+
+	hash.Set(HashPair{Key: keys[0], Value: &Integer{Value: 10}})
+
+	if hash.Inspect() != "{c: 10, a: 1, b: 2}" {
+		t.Errorf("hash has wrong order, got=%q", hash.Inspect())
+	}
+
+	hash.Delete(keys[1])
+
+	if hash.Inspect() != "{c: 10, b: 2}" {
+		t.Errorf("hash has wrong order after delete, got=%q", hash.Inspect())
+	}
+
+	hash.Set(HashPair{Key: keys[1], Value: &Integer{Value: 1}})
+
+	if hash.Inspect() != "{c: 10, b: 2, a: 1}" {
+		t.Errorf("hash has wrong order after reinsert, got=%q", hash.Inspect())
+	}
+}
+
+func TestFrozenHash(t *testing.T) {
+	hash := NewHash()
+	key := &String{Value: "a"}
+	hash.Set(HashPair{Key: key, Value: &Integer{Value: 1}})
+	hash.Frozen = true
+
+	if err := hash.Set(HashPair{Key: key, Value: &Integer{Value: 2}}); err == nil || err.Message != "cannot modify frozen HASH: {a: 1}" {
+		t.Errorf("Set on a frozen hash gave wrong error, got=%v", err)
+	}
+
+	if err := hash.Delete(key); err == nil || err.Message != "cannot modify frozen HASH: {a: 1}" {
+		t.Errorf("Delete on a frozen hash gave wrong error, got=%v", err)
+	}
+
+	if hash.Inspect() != "{a: 1}" {
+		t.Errorf("frozen hash was changed, got=%q", hash.Inspect())
+	}
+
+	if copied := hash.Copy(); copied.Frozen || copied.Set(HashPair{Key: key, Value: &Integer{Value: 2}}) != nil {
+		t.Errorf("copy of a frozen hash is not writable")
+	}
+}
+
+func TestArrayHashKey(t *testing.T) {
+	pair1 := &Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "a"}}}
+	pair2 := &Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "a"}}}
+	swapped := &Array{Elements: []Object{&String{Value: "a"}, &Integer{Value: 1}}}
+	nested := &Array{Elements: []Object{&Array{Elements: []Object{&Integer{Value: 1}}}}}
+
+	if pair1.HashKey() != pair2.HashKey() {
+		t.Errorf("arrays with same content have different hash keys")
+	}
+
+	if pair1.HashKey() == swapped.HashKey() {
+		t.Errorf("arrays with different order have same hash keys")
+	}
+
+	if !IsHashable(nested) {
+		t.Errorf("nested array of integers should be hashable")
+	}
+
+	if IsHashable(&Array{Elements: []Object{&Function{}}}) {
+		t.Errorf("array containing a function should not be hashable")
+	}
+}
+
+func TestHashHashKey(t *testing.T) {
+	first := NewHash()
+	first.Set(HashPair{Key: &String{Value: "a"}, Value: &Integer{Value: 1}})
+	first.Set(HashPair{Key: &String{Value: "b"}, Value: &Integer{Value: 2}})
+
+	second := NewHash()
+	second.Set(HashPair{Key: &String{Value: "b"}, Value: &Integer{Value: 2}})
+	second.Set(HashPair{Key: &String{Value: "a"}, Value: &Integer{Value: 1}})
+
+	if first.HashKey() != second.HashKey() {
+		t.Errorf("hashes with same pairs in different order have different hash keys")
+	}
+
+	second.Set(HashPair{Key: &String{Value: "a"}, Value: &Integer{Value: 3}})
+
+	if first.HashKey() == second.HashKey() {
+		t.Errorf("hashes with different values have same hash keys")
+	}
+}
+
+type CollidingKey struct {
+	Value string
+}
+
+func (c *CollidingKey) Type() ObjectType { return "COLLIDING" }
+func (c *CollidingKey) Inspect() string { return c.Value }
+func (c *CollidingKey) HashKey() HashKey { return HashKey{Type: STRING_OBJ, Value: 42} }
+
+func TestHashKeyCollision(t *testing.T) {
+	first := &CollidingKey{Value: "first"}
+	second := &CollidingKey{Value: "second"}
+
+	hash := NewHash()
+	hash.Set(HashPair{Key: first, Value: &Integer{Value: 1}})
+	hash.Set(HashPair{Key: second, Value: &Integer{Value: 2}})
+
+	if len(hash.Pairs) != 2 {
+		t.Fatalf("colliding keys overwrote each other, got=%d pairs", len(hash.Pairs))
+	}
+
+	pair, okay := hash.Get(first)
+	if !okay || pair.Value.(*Integer).Value != 1 {
+		t.Errorf("wrong value for first colliding key, got=%+v", pair)
+	}
+
+	pair, okay = hash.Get(second)
+	if !okay || pair.Value.(*Integer).Value != 2 {
+		t.Errorf("wrong value for second colliding key, got=%+v", pair)
+	}
+
+	hash.Delete(first)
+
+	if _, okay := hash.Get(first); okay {
+		t.Errorf("first colliding key still present after delete")
+	}
+
+	if _, okay := hash.Get(second); !okay {
+		t.Errorf("second colliding key lost after deleting first")
+	}
+}
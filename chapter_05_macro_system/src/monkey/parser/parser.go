@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 	"monkey/ast"
 	"monkey/lexer"
 	"monkey/token"
@@ -11,8 +12,15 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	TERNARY		// ? :
+	PIPELINE	// |>
+	COALESCE	// ??
 	EQUALS		// ==
 	LESSGREATER	// < or >
+	BIT_OR		// |
+	BIT_XOR		// ^
+	BIT_AND		// &
+	SHIFT		// <<, >> or >>>
 	SUM			// +
 	PRODUCT		// *
 	PREFIX		// - or !
@@ -25,13 +33,52 @@ var precedences = map[token.TokenType] int {
 	token.NOT_EQ:	EQUALS,
 	token.LT:		LESSGREATER,
 	token.GT:		LESSGREATER,
+	token.PIPE:			BIT_OR,
+	token.CARET:		BIT_XOR,
+	token.AMPERSAND:	BIT_AND,
+	token.SHIFT_LEFT:	SHIFT,
+	token.SHIFT_RIGHT:	SHIFT,
+	token.COMPOSE:		SHIFT,
+	token.PIPELINE:		PIPELINE,
 	token.PLUS:		SUM,
 	token.MINUS:	SUM,
 	token.SLASH:	PRODUCT,
 	token.ASTERISK:	PRODUCT,
 	token.LPAREN:	CALL,
 	token.LBRACKET:	INDEX,
-}
+	token.OPTIONAL_LBRACKET:	INDEX,
+	token.NULL_COALESCE:		COALESCE,
+	token.QUESTION:				TERNARY,
+}
+
+// Operator is an infix operator declared by an infix statement, its
+// precedence is on the scale of the built-in ones
+type Operator struct {
+	Symbol string
+	Precedence int
+	RightAssociative bool
+}
+
+// DeclaredPrecedences maps the precedence an infix statement gives, less
+// one, to the built-in level it binds like. The table is fixed so that
+// adding a built-in level does not change what declared precedences mean
+var DeclaredPrecedences = [...]int{
+	TERNARY,		// 1
+	COALESCE,		// 2
+	EQUALS,			// 3
+	LESSGREATER,	// 4
+	BIT_OR,			// 5
+	BIT_XOR,		// 6
+	BIT_AND,		// 7
+	SHIFT,			// 8
+	SUM,			// 9
+	PRODUCT,		// 10
+	PREFIX,			// 11
+}
+
+// MAX_OPERATOR_PRECEDENCE is the highest precedence an infix statement
+// may give
+const MAX_OPERATOR_PRECEDENCE = len(DeclaredPrecedences)
 
 type (
 	PrefixParseFn func() ast.Expression
@@ -56,10 +103,24 @@ type Parser struct {
 
 	PrefixParseFns map[token.TokenType] PrefixParseFn
 	InfixParseFns map[token.TokenType] InfixParseFn
+
+	Operators map[string] Operator
+
+	binding bool	// parsing a binding pattern, where {name} is allowed
 }
 
 func NewParser(l *lexer.Lexer) *Parser {
-	p := &Parser{lexer: l, errors: []string{}}
+	return NewParserWithOperators(l, nil)
+}
+
+// NewParserWithOperators returns a parser that knows the given operators
+// from the start, e.g. those declared by earlier input to the REPL
+func NewParserWithOperators(l *lexer.Lexer, operators map[string] Operator) *Parser {
+	p := &Parser{lexer: l, errors: []string{}, Operators: make(map[string] Operator)}
+
+	for _, operator := range operators {
+		p.DefineOperator(operator)
+	}
 
 	// init prefix parse functions map
 	p.PrefixParseFns = make(map[token.TokenType] PrefixParseFn)
@@ -68,8 +129,12 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.RegisterPrefixParseFn(token.INT, p.ParseIntegerLiteral)
 	p.RegisterPrefixParseFn(token.BANG, p.ParsePrefixExpression)
 	p.RegisterPrefixParseFn(token.MINUS, p.ParsePrefixExpression)
+	p.RegisterPrefixParseFn(token.TILDE, p.ParsePrefixExpression)
 	p.RegisterPrefixParseFn(token.TRUE, p.ParseBoolean)
 	p.RegisterPrefixParseFn(token.FALSE, p.ParseBoolean)
+	p.RegisterPrefixParseFn(token.NULL, p.ParseNullLiteral)
+	p.RegisterPrefixParseFn(token.MATCH, p.ParseMatchExpression)
+	p.RegisterPrefixParseFn(token.ELLIPSIS, p.ParseSpreadExpression)
 	p.RegisterPrefixParseFn(token.LPAREN, p.ParseGroupedExpression)
 	p.RegisterPrefixParseFn(token.IF, p.ParseIfExpression)
 	p.RegisterPrefixParseFn(token.FUNCTION, p.ParseFunctionLiteral)
@@ -89,8 +154,19 @@ func NewParser(l *lexer.Lexer) *Parser {
 	p.RegisterInfixParseFn(token.NOT_EQ, p.ParseInfixExpression)
 	p.RegisterInfixParseFn(token.LT, p.ParseInfixExpression)
 	p.RegisterInfixParseFn(token.GT, p.ParseInfixExpression)
+	p.RegisterInfixParseFn(token.AMPERSAND, p.ParseInfixExpression)
+	p.RegisterInfixParseFn(token.PIPE, p.ParseInfixExpression)
+	p.RegisterInfixParseFn(token.CARET, p.ParseInfixExpression)
+	p.RegisterInfixParseFn(token.SHIFT_LEFT, p.ParseInfixExpression)
+	p.RegisterInfixParseFn(token.SHIFT_RIGHT, p.ParseInfixExpression)
+	p.RegisterInfixParseFn(token.COMPOSE, p.ParseInfixExpression)
+	p.RegisterInfixParseFn(token.PIPELINE, p.ParseInfixExpression)
 	p.RegisterInfixParseFn(token.LPAREN, p.ParseCallExpression)
 	p.RegisterInfixParseFn(token.LBRACKET, p.ParseIndexExpression)
+	p.RegisterInfixParseFn(token.OPTIONAL_LBRACKET, p.ParseIndexExpression)
+	p.RegisterInfixParseFn(token.NULL_COALESCE, p.ParseInfixExpression)
+	p.RegisterInfixParseFn(token.QUESTION, p.ParseConditionalExpression)
+	p.RegisterInfixParseFn(token.OPERATOR, p.ParseInfixExpression)
 
 	// set both CurrToken and PeekToken
 	p.NextToken()
@@ -113,19 +189,37 @@ func (p *Parser) PeekTokenIs(t token.TokenType) bool {
 }
 
 func (p *Parser) CurrPrecedence() int {
-	if precedence, okay := precedences[p.CurrToken.Type]; okay {
-		return precedence
-	}
-	return LOWEST
+	return p.Precedence(p.CurrToken)
 }
 
 func (p *Parser) PeekPrecedence() int {
-	if precedence, okay := precedences[p.PeekToken.Type]; okay {
+	return p.Precedence(p.PeekToken)
+}
+
+func (p *Parser) Precedence(t token.Token) int {
+	if t.Type == token.OPERATOR {
+		if operator, okay := p.Operators[t.Literal]; okay {
+			return operator.Precedence
+		}
+	}
+	if precedence, okay := precedences[t.Type]; okay {
 		return precedence
 	}
 	return LOWEST
 }
 
+// DefineOperator adds an operator to those the parser and its lexer know
+func (p *Parser) DefineOperator(operator Operator) {
+	p.Operators[operator.Symbol] = operator
+	p.lexer.DefineOperator(operator.Symbol)
+}
+
+// OperatorName is the name of the variable holding the function of a
+// declared operator, it cannot clash with an identifier
+func OperatorName(symbol string) string {
+	return "infix " + symbol
+}
+
 func (p *Parser) ExpectedPeek(t token.TokenType) bool {
 	if p.PeekTokenIs(t) {
 		p.NextToken()
@@ -167,24 +261,42 @@ func (p *Parser) ParseProgram() *ast.Program {
 
 func (p *Parser) ParseStatement() ast.Statement {
 	switch p.CurrToken.Type {
-	case token.LET:
+	case token.LET, token.CONST:
 		return p.ParseLetStatement()
 	case token.RETURN:
 		return p.ParseReturnStatement()
+	case token.INFIX:
+		return p.ParseInfixDeclaration()
 	default:
 		return p.ParseExpressionStatement()
 	}
 }
 
 func (p *Parser) ParseLetStatement() *ast.LetStatement {
-	stmt := &ast.LetStatement{Token: p.CurrToken}
+	stmt := &ast.LetStatement{Token: p.CurrToken, Constant: p.CurrTokenIs(token.CONST)}
 
-	if !p.ExpectedPeek(token.IDENT) {
-		return nil
+	if p.PeekTokenIs(token.LBRACKET) || p.PeekTokenIs(token.LBRACE) {
+		p.NextToken()
+
+		stmt.Pattern = p.ParseBindingPattern()
+		if stmt.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.ExpectedPeek(token.IDENT) {
+			return nil
+		}
+
+		stmt.Name = &ast.Identifier{Token: p.CurrToken, Value: p.CurrToken.Literal};
+	}
+
+	if p.PeekTokenIs(token.COLON) {
+		p.NextToken()
+		if stmt.Type = p.ParseTypeAnnotation(); stmt.Type == nil {
+			return nil
+		}
 	}
 
-	stmt.Name = &ast.Identifier{Token: p.CurrToken, Value: p.CurrToken.Literal};
-	
 	if !p.ExpectedPeek(token.ASSIGN) {
 		return nil
 	}
@@ -193,6 +305,10 @@ func (p *Parser) ParseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.ParseExpression(LOWEST)
 
+	if function, okay := stmt.Value.(*ast.FunctionLiteral); okay && stmt.Name != nil {
+		function.Name = stmt.Name.Value
+	}
+
 	if p.PeekTokenIs(token.SEMICOLON) {
 		p.NextToken()
 	}
@@ -200,6 +316,78 @@ func (p *Parser) ParseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+// ParseInfixDeclaration parses `infix op precedence [left|right] = fn`.
+// The operator is known from there on, also within fn.
+func (p *Parser) ParseInfixDeclaration() ast.Statement {
+	stmt := &ast.InfixDeclaration{Token: p.CurrToken}
+
+	if !p.ExpectedPeek(token.OPERATOR) {
+		return nil
+	}
+	stmt.Operator = p.CurrToken.Literal
+	stmt.Name = &ast.Identifier{Token: p.CurrToken, Value: OperatorName(stmt.Operator)}
+
+	if IsBuiltinOperator(stmt.Operator) {
+		p.errors = append(p.errors, fmt.Sprintf("cannot redefine built-in operator %s", stmt.Operator))
+		return nil
+	}
+
+	if !p.ExpectedPeek(token.INT) {
+		return nil
+	}
+	precedence, err := strconv.Atoi(p.CurrToken.Literal)
+	if err != nil || precedence < 1 || precedence > MAX_OPERATOR_PRECEDENCE {
+		msg := fmt.Sprintf("operator precedence must be between 1 and %d, got %s", MAX_OPERATOR_PRECEDENCE, p.CurrToken.Literal)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	stmt.Precedence = precedence
+
+	if p.PeekTokenIs(token.IDENT) {
+		p.NextToken()
+		switch p.CurrToken.Literal {
+		case "left":
+		case "right":
+			stmt.RightAssociative = true
+		default:
+			p.errors = append(p.errors, fmt.Sprintf("expected left or right after operator precedence, got %s instead", p.CurrToken.Literal))
+			return nil
+		}
+	}
+
+	p.DefineOperator(Operator{Symbol: stmt.Operator, Precedence: DeclaredPrecedences[precedence-1], RightAssociative: stmt.RightAssociative})
+
+	if !p.ExpectedPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.NextToken() // skip =
+
+	stmt.Function = p.ParseExpression(LOWEST)
+
+	if function, okay := stmt.Function.(*ast.FunctionLiteral); okay {
+		function.Name = stmt.Name.Value
+	}
+
+	if p.PeekTokenIs(token.SEMICOLON) {
+		p.NextToken()
+	}
+
+	return stmt
+}
+
+// IsBuiltinOperator reports whether symbol is read as a single built-in
+// token, such as + or =>. The |> and >>> operators are not counted, an
+// infix statement may shadow them as they came after infix statements
+func IsBuiltinOperator(symbol string) bool {
+	l := lexer.NewLexer(symbol)
+	t := l.NextToken()
+	if t.Type == token.PIPELINE || t.Type == token.COMPOSE {
+		return false
+	}
+	return t.Literal == symbol && t.Type != token.ILLEGAL && l.NextToken().Type == token.EOF
+}
+
 func (p *Parser) ParseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{Token: p.CurrToken}
 
@@ -261,8 +449,13 @@ func (p *Parser) ParseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.CurrToken.Literal, 0, 64)
 
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.CurrToken.Literal)
-		p.errors = append(p.errors, msg)
+		BigValue, okay := new(big.Int).SetString(p.CurrToken.Literal, 0)
+		if !okay {
+			msg := fmt.Sprintf("could not parse %q as integer", p.CurrToken.Literal)
+			p.errors = append(p.errors, msg)
+		}
+		literal.Big = BigValue
+		return literal
 	}
 
 	literal.Value = value
@@ -288,6 +481,15 @@ func (p *Parser) ParseInfixExpression(operand ast.Expression) ast.Expression {
 	}
 
 	precedence := p.CurrPrecedence()
+
+	if p.CurrTokenIs(token.OPERATOR) {
+		expression.Function = &ast.Identifier{Token: p.CurrToken, Value: OperatorName(p.CurrToken.Literal)}
+		// the right operand takes in operators of the same precedence
+		if p.Operators[p.CurrToken.Literal].RightAssociative {
+			precedence -= 1
+		}
+	}
+
 	p.NextToken()
 	expression.OperandRight = p.ParseExpression(precedence)
 
@@ -298,6 +500,10 @@ func (p *Parser) ParseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.CurrToken, Value: p.CurrTokenIs(token.TRUE)}
 }
 
+func (p *Parser) ParseNullLiteral() ast.Expression {
+	return &ast.NullLiteral{Token: p.CurrToken}
+}
+
 func (p *Parser) ParseGroupedExpression() ast.Expression {
 	p.NextToken()
 
@@ -343,6 +549,92 @@ func (p *Parser) ParseIfExpression() ast.Expression {
 	return expression
 }
 
+func (p *Parser) ParseConditionalExpression(condition ast.Expression) ast.Expression {
+	expression := &ast.ConditionalExpression{Token: p.CurrToken, Condition: condition}
+
+	p.NextToken()
+	expression.Consequence = p.ParseExpression(LOWEST)
+
+	if !p.ExpectedPeek(token.COLON) {
+		return nil
+	}
+
+	p.NextToken()
+	// one below TERNARY, so that a ? b : c ? d : e groups to the right
+	expression.Alternative = p.ParseExpression(TERNARY - 1)
+
+	return expression
+}
+
+func (p *Parser) ParseMatchExpression() ast.Expression {
+	expression := &ast.MatchExpression{Token: p.CurrToken}
+
+	if !p.ExpectedPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.NextToken()
+	expression.Subject = p.ParseExpression(LOWEST)
+
+	if !p.ExpectedPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.ExpectedPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.PeekTokenIs(token.RBRACE) {
+		p.NextToken()
+
+		arm := p.ParseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		if !p.PeekTokenIs(token.RBRACE) && !p.ExpectedPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.ExpectedPeek(token.RBRACE) {
+		return nil
+	}
+
+	return expression
+}
+
+func (p *Parser) ParseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Token: p.CurrToken}
+
+	arm.Pattern = p.ParseExpression(LOWEST)
+
+	if p.PeekTokenIs(token.IF) {
+		p.NextToken() // skip pattern
+		p.NextToken() // skip if
+		arm.Guard = p.ParseExpression(LOWEST)
+	}
+
+	if !p.ExpectedPeek(token.ARROW) {
+		return nil
+	}
+
+	p.NextToken()
+	arm.Body = p.ParseExpression(LOWEST)
+
+	return arm
+}
+
+func (p *Parser) ParseSpreadExpression() ast.Expression {
+	expression := &ast.SpreadExpression{Token: p.CurrToken}
+
+	p.NextToken()
+	expression.Value = p.ParseExpression(PREFIX)
+
+	return expression
+}
+
 func (p *Parser) ParseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{
 		Token: p.CurrToken,
@@ -370,7 +662,14 @@ func (p *Parser) ParseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	function.Parameters = p.ParseFunctionParameters()
+	function.Parameters, function.ParameterTypes = p.ParseFunctionParameters()
+
+	if p.PeekTokenIs(token.THIN_ARROW) {
+		p.NextToken()
+		if function.ReturnType = p.ParseTypeAnnotation(); function.ReturnType == nil {
+			return nil
+		}
+	}
 
 	if !p.ExpectedPeek(token.LBRACE) {
 		return nil
@@ -381,31 +680,168 @@ func (p *Parser) ParseFunctionLiteral() ast.Expression {
 	return function
 }
 
-func (p *Parser) ParseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// ParseFunctionParameters also returns the parameter type annotations,
+// nil when there are none
+func (p *Parser) ParseFunctionParameters() ([]ast.Expression, []*ast.TypeAnnotation) {
+	parameters := []ast.Expression{}
+	types := []*ast.TypeAnnotation{}
+	annotated := false
 
 	p.NextToken() // skip (
 
 	if p.CurrTokenIs(token.RPAREN) {
-		return identifiers
+		return parameters, nil
 	}
 
-	identifier := &ast.Identifier{Token: p.CurrToken, Value: p.CurrToken.Literal}
-	identifiers = append(identifiers, identifier)
+	for {
+		parameter, annotation := p.ParseFunctionParameter()
+		parameters = append(parameters, parameter)
+		types = append(types, annotation)
+		annotated = annotated || annotation != nil
 
-	for p.PeekTokenIs(token.COMMA) {
-		p.NextToken() // skip identifier
-		p.NextToken() // skip ,
+		if !p.PeekTokenIs(token.COMMA) {
+			break
+		}
 
-		identifier := &ast.Identifier{Token: p.CurrToken, Value: p.CurrToken.Literal}
-		identifiers = append(identifiers, identifier)
+		p.NextToken() // skip parameter
+		p.NextToken() // skip ,
 	}
 
 	if !p.ExpectedPeek(token.RPAREN) {
+		return nil, nil
+	}
+
+	p.CheckFunctionParameters(parameters)
+
+	if !annotated {
+		types = nil
+	}
+
+	return parameters, types
+}
+
+// ParseFunctionParameter parses a binding pattern with an optional default
+// value, or a ...rest parameter
+func (p *Parser) ParseFunctionParameter() (ast.Expression, *ast.TypeAnnotation) {
+	if p.CurrTokenIs(token.ELLIPSIS) {
+		rest := &ast.SpreadExpression{Token: p.CurrToken}
+
+		if !p.ExpectedPeek(token.IDENT) {
+			return nil, nil
+		}
+
+		rest.Value = &ast.Identifier{Token: p.CurrToken, Value: p.CurrToken.Literal}
+		return rest, p.ParseOptionalTypeAnnotation()
+	}
+
+	pattern := p.ParseBindingPattern()
+	if pattern == nil {
+		return nil, nil
+	}
+
+	annotation := p.ParseOptionalTypeAnnotation()
+
+	if p.PeekTokenIs(token.ASSIGN) {
+		p.NextToken()
+		parameter := &ast.DefaultParameter{Token: p.CurrToken, Pattern: pattern}
+
+		p.NextToken()
+		parameter.Default = p.ParseExpression(LOWEST)
+
+		return parameter, annotation
+	}
+
+	return pattern, annotation
+}
+
+// ParseOptionalTypeAnnotation parses `: type` if it follows
+func (p *Parser) ParseOptionalTypeAnnotation() *ast.TypeAnnotation {
+	if !p.PeekTokenIs(token.COLON) {
+		return nil
+	}
+	p.NextToken()
+	return p.ParseTypeAnnotation()
+}
+
+// ParseTypeAnnotation parses the type name following the current : or ->
+// token. The keywords fn and null are valid type names.
+func (p *Parser) ParseTypeAnnotation() *ast.TypeAnnotation {
+	if !p.PeekTokenIs(token.IDENT) && !p.PeekTokenIs(token.FUNCTION) && !p.PeekTokenIs(token.NULL) {
+		msg := fmt.Sprintf("expected type name after %s, got %s instead", p.CurrToken.Literal, p.PeekToken.Type)
+		p.errors = append(p.errors, msg)
+		return nil
+	}
+	p.NextToken()
+
+	return &ast.TypeAnnotation{Token: p.CurrToken, Name: p.CurrToken.Literal}
+}
+
+// CheckFunctionParameters reports a rest parameter that is not the last one
+// and required parameters following ones with a default value
+func (p *Parser) CheckFunctionParameters(parameters []ast.Expression) {
+	HasDefault := false
+
+	for i, parameter := range parameters {
+		switch parameter.(type) {
+		case *ast.SpreadExpression:
+			if i != len(parameters) - 1 {
+				msg := fmt.Sprintf("rest parameter %s must be the last parameter", parameter)
+				p.errors = append(p.errors, msg)
+			}
+		case *ast.DefaultParameter:
+			HasDefault = true
+		case nil:
+		default:
+			if HasDefault {
+				msg := fmt.Sprintf("parameter %s without default follows parameter with default", parameter)
+				p.errors = append(p.errors, msg)
+			}
+		}
+	}
+}
+
+// ParseBindingPattern parses what a let statement or a function parameter
+// binds to: an identifier, or array and hash literals made of patterns
+func (p *Parser) ParseBindingPattern() ast.Expression {
+	binding := p.binding
+	p.binding = true
+	pattern := p.ParseExpression(LOWEST)
+	p.binding = binding
+
+	if pattern != nil && !IsBindingPattern(pattern) {
+		msg := fmt.Sprintf("invalid binding pattern: %s", pattern.String())
+		p.errors = append(p.errors, msg)
 		return nil
 	}
 
-	return identifiers
+	return pattern
+}
+
+func IsBindingPattern(pattern ast.Expression) bool {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		return true
+	case *ast.ArrayLiteral:
+		for i, element := range pattern.Elements {
+			if spread, okay := element.(*ast.SpreadExpression); okay && i == len(pattern.Elements) - 1 {
+				_, okay = spread.Value.(*ast.Identifier)
+				return okay
+			}
+			if !IsBindingPattern(element) {
+				return false
+			}
+		}
+		return true
+	case *ast.HashLiteral:
+		for _, key := range pattern.Keys {
+			if !IsBindingPattern(pattern.Pairs[key]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
 }
 
 func (p *Parser) ParseCallExpression(function ast.Expression) ast.Expression {
@@ -452,7 +888,11 @@ func (p *Parser) ParseExpressionList(EndToken token.TokenType) []ast.Expression
 }
 
 func (p *Parser) ParseIndexExpression(array ast.Expression) ast.Expression {
-	expression := &ast.IndexExpression{Token: p.CurrToken, Array: array}
+	expression := &ast.IndexExpression{
+		Token: p.CurrToken,
+		Array: array,
+		Optional: p.CurrTokenIs(token.OPTIONAL_LBRACKET),
+	}
 
 	p.NextToken()
 	expression.Index = p.ParseExpression(LOWEST)
@@ -472,6 +912,25 @@ func (p *Parser) ParseHashLiteral() ast.Expression {
 		p.NextToken()
 		key := p.ParseExpression(LOWEST)
 
+		// {name} is a shorthand for {"name": name} in binding patterns
+		if identifier, okay := key.(*ast.Identifier); okay && (p.PeekTokenIs(token.COMMA) || p.PeekTokenIs(token.RBRACE)) {
+			if !p.binding {
+				msg := fmt.Sprintf("hash shorthand {%s} is only allowed in let and parameter patterns", identifier.Value)
+				p.errors = append(p.errors, msg)
+				return nil
+			}
+
+			t := token.Token{Type: token.STRING, Literal: identifier.Value}
+			key = &ast.StringLiteral{Token: t, Value: identifier.Value}
+			hash.Pairs[key] = identifier
+			hash.Keys = append(hash.Keys, key)
+
+			if !p.PeekTokenIs(token.RBRACE) && !p.ExpectedPeek(token.COMMA) {
+				return nil
+			}
+			continue
+		}
+
 		if !p.ExpectedPeek(token.COLON) {
 			return nil
 		}
@@ -480,6 +939,7 @@ func (p *Parser) ParseHashLiteral() ast.Expression {
 		val := p.ParseExpression(LOWEST)
 
 		hash.Pairs[key] = val
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.PeekTokenIs(token.RBRACE) && !p.ExpectedPeek(token.COMMA) {
 			return nil
@@ -500,7 +960,22 @@ func (p *Parser) ParseMacroLiteral() ast.Expression {
         return nil
     }
 
-    macro.Parameters = p.ParseFunctionParameters()
+    parameters, types := p.ParseFunctionParameters()
+    if types != nil {
+        p.errors = append(p.errors, "macro parameters cannot have type annotations")
+        return nil
+    }
+
+    macro.Parameters = []*ast.Identifier{}
+    for _, param := range parameters {
+        identifier, okay := param.(*ast.Identifier)
+        if !okay {
+            msg := fmt.Sprintf("macro parameters must be identifiers, got %s", param)
+            p.errors = append(p.errors, msg)
+            return nil
+        }
+        macro.Parameters = append(macro.Parameters, identifier)
+    }
 
     if !p.ExpectedPeek(token.LBRACE) {
         return nil
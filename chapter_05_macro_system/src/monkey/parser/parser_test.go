@@ -81,6 +81,100 @@ func TestLetStatement(t *testing.T) {
 	}
 }
 
+func TestConstStatement(t *testing.T) {
+	input := "const limit = 10; const [a, b] = pair;"
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	CheckParseErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements, got=%d", len(program.Statements))
+	}
+
+	for _, stmt := range program.Statements {
+		let, okay := stmt.(*ast.LetStatement)
+		if !okay {
+			t.Fatalf("stmt is not *ast.LetStatement, got=%T", stmt)
+		}
+
+		if !let.Constant {
+			t.Errorf("let.Constant is false for %q", let.String())
+		}
+	}
+
+	if program.String() != "const limit = 10;const [a, b] = pair;" {
+		t.Errorf("program.String() wrong, got=%q", program.String())
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{ "let x: int = 5;", "let x: int = 5;" },
+		{ "const [a, b]: array = pair;", "const [a, b]: array = pair;" },
+		{ "fn(x: int, y) -> bool { x }", "fn(x: int, y) -> bool x" },
+		{ "fn(x, y: string = \"a\", ...rest: array) { x }", "fn(x, y: string = a, ...rest: array) x" },
+		{ "fn(f: fn, n: null) -> fn { f }", "fn(f: fn, n: null) -> fn f" },
+		{ "fn(x, y) { x - 1 }", "fn(x, y) (x - 1)" },
+		{ "let x = a ? b : c;", "let x = (a ? b : c);" },
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		CheckParseErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q, got=%q, want=%q", tt.input, program.String(), tt.expected)
+		}
+	}
+
+	l := lexer.NewLexer("fn(a: int, b, c = 1) -> int { a }")
+	p := NewParser(l)
+	program := p.ParseProgram()
+	CheckParseErrors(t, p)
+
+	function := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(function.ParameterTypes) != 3 || function.ParameterTypes[0].Name != "int" || function.ParameterTypes[1] != nil || function.ParameterTypes[2] != nil {
+		t.Errorf("wrong parameter types, got=%v", function.ParameterTypes)
+	}
+	if function.ReturnType == nil || function.ReturnType.Name != "int" {
+		t.Errorf("wrong return type, got=%v", function.ReturnType)
+	}
+
+	l = lexer.NewLexer("fn(a, b) { a }")
+	p = NewParser(l)
+	program = p.ParseProgram()
+	function = program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if function.ParameterTypes != nil || function.ReturnType != nil {
+		t.Errorf("unannotated function has types, got=%v, %v", function.ParameterTypes, function.ReturnType)
+	}
+
+	errors := []struct {
+		input string
+		expected string
+	}{
+		{ "let x: = 5;", "expected type name after :, got = instead" },
+		{ "fn(x) -> 5 { x }", "expected type name after ->, got INT instead" },
+		{ "macro(x: int) { x }", "macro parameters cannot have type annotations" },
+	}
+
+	for _, tt := range errors {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		p.ParseProgram()
+
+		if len(p.GetErrors()) == 0 || p.GetErrors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q, got=%v, want=%q", tt.input, p.GetErrors(), tt.expected)
+		}
+	}
+}
+
 func TestReturnStatement(t *testing.T) {
 	input := `return 5;
 	return 10;
@@ -182,6 +276,46 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralPrefixes(t *testing.T) {
+	tests := []struct {
+		input string
+		expected int64
+	}{
+		{"0x1F;", 31},
+		{"0b101;", 5},
+		{"0o777;", 511},
+		{"1_000;", 1000},
+		{"0b1111_0000;", 240},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		CheckParseErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, okay := stmt.Expression.(*ast.IntegerLiteral)
+		if !okay {
+			t.Fatalf("stmt.Expression is not ast.IntegerLiteral, got=%T", stmt.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %d, got=%d", tt.expected, literal.Value)
+		}
+	}
+
+	for _, input := range []string{"0x;", "1__0;", "1_;", "0b102;"} {
+		l := lexer.NewLexer(input)
+		p := NewParser(l)
+		p.ParseProgram()
+
+		if len(p.GetErrors()) == 0 {
+			t.Errorf("expected parse error for %q", input)
+		}
+	}
+}
+
 func TestPrefixExpression(t *testing.T) {
 	tests := []struct {
 		input string
@@ -353,6 +487,8 @@ func TestInfixExpression(t *testing.T) {
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
+		{"a |> b", "a", "|>", "b"},
+		{"f >>> g", "f", ">>>", "g"},
 	}
 
 	for _, tt := range tests {
@@ -424,6 +560,30 @@ func TestOperatorPrecedence(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{"a & b | c ^ d", "((a & b) | (c ^ d))"},
+		{"a | b & c == d", "((a | (b & c)) == d)"},
+		{"a << b + c", "(a << (b + c))"},
+		{"a < b >> c", "(a < (b >> c))"},
+		{"~a & -b", "((~a) & (-b))"},
+		{"a ?? b == c", "(a ?? (b == c))"},
+		{"a ?? b ?? null", "((a ?? b) ?? null)"},
+		{"a?[b]?[c + 1]", "((a?[b])?[(c + 1)])"},
+		{"a ? b : c", "(a ? b : c)"},
+		{"a == b ? c + 1 : d ?? e", "((a == b) ? (c + 1) : (d ?? e))"},
+		{"a ? b : c ? d : e", "(a ? b : (c ? d : e))"},
+		{"a ? b ? c : d : e", "(a ? (b ? c : d) : e)"},
+		{"c ? [1] : [2]", "(c ? [1] : [2])"},
+		{"xs |> map(f) |> filter(g) |> sum", "(((xs |> map(f)) |> filter(g)) |> sum)"},
+		{"a + b |> f(c * d)", "((a + b) |> f((c * d)))"},
+		{"a ?? b |> f", "((a ?? b) |> f)"},
+		{"a |> f ? b : c", "((a |> f) ? b : c)"},
+		{"f >>> g >>> h", "((f >>> g) >>> h)"},
+		{"xs |> f >>> g", "(xs |> (f >>> g))"},
+		{"a >> b >>> c", "((a >> b) >>> c)"},
+		{
+			`{"z": 1, "a": 2 * 3, "m": b}`,
+			`{z: 1, a: (2 * 3), m: b}`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -1053,4 +1213,323 @@ func TestMacroLiteral(t *testing.T) {
     }
 
     CheckInfixExpression(t, body.Expression, "x", "+", "y")
-}
\ No newline at end of file
+}
+
+func TestMatchExpression(t *testing.T) {
+	input := `match (x + 1) {
+		0 => "zero",
+		[a, ...rest] if (a > 1) => rest,
+		{"name": n} => n,
+		_ => null,
+	}`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	CheckParseErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statement, got=%d", len(program.Statements))
+	}
+
+	stmt, okay := program.Statements[0].(*ast.ExpressionStatement)
+	if !okay {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement, got=%T", program.Statements[0])
+	}
+
+	match, okay := stmt.Expression.(*ast.MatchExpression)
+	if !okay {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression, got=%T", stmt.Expression)
+	}
+
+	if !CheckInfixExpression(t, match.Subject, "x", "+", 1) {
+		return
+	}
+
+	if len(match.Arms) != 4 {
+		t.Fatalf("match has wrong number of arms, got=%d", len(match.Arms))
+	}
+
+	CheckIntegerLiteral(t, match.Arms[0].Pattern, 0)
+
+	if match.Arms[1].Guard == nil {
+		t.Fatalf("second arm has no guard")
+	}
+
+	CheckInfixExpression(t, match.Arms[1].Guard, "a", ">", 1)
+	CheckIdentifier(t, match.Arms[3].Pattern, "_")
+
+	expected := `match ((x + 1)) { 0 => zero, [a, ...rest] if (a > 1) => rest, {name: n} => n, _ => null }`
+	if match.String() != expected {
+		t.Errorf("match.String() wrong, want=%q, got=%q", expected, match.String())
+	}
+
+	for _, input := range []string{"match (x) { 1 2 }", "match (x) { 1 => 2 3 => 4 }", "match x { _ => 1 }"} {
+		p := NewParser(lexer.NewLexer(input))
+		p.ParseProgram()
+
+		if len(p.GetErrors()) == 0 {
+			t.Errorf("expected parse error for %q", input)
+		}
+	}
+}
+
+func TestDestructuringPatterns(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{"let [a, b] = pair;", "let [a, b] = pair;"},
+		{"let [a, [b, c], ...rest] = xs;", "let [a, [b, c], ...rest] = xs;"},
+		{"let {name, age} = person;", "let {name: name, age: age} = person;"},
+		{`let {"first": [x, y]} = h;`, "let {first: [x, y]} = h;"},
+		{"fn([a, b], {name}) { a }", "fn([a, b], {name: name}) a"},
+		{"let {a, \"b\": [c, {d}]} = h;", "let {a: a, b: [c, {d: d}]} = h;"},
+		{"fn({a} = {\"a\": 1}) { a }", "fn({a: a} = {a: 1}) a"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p := NewParser(l)
+		program := p.ParseProgram()
+		CheckParseErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+
+	invalid := []string{
+		"let [a + 1] = xs;",
+		"let [...rest, a] = xs;",
+		"let [a, ...[b]] = xs;",
+		"let {name: 1} = h;",
+		"fn(a, 1) { a }",
+		"macro([a]) { a }",
+	}
+
+	for _, input := range invalid {
+		p := NewParser(lexer.NewLexer(input))
+		p.ParseProgram()
+
+		if len(p.GetErrors()) == 0 {
+			t.Errorf("expected parse error for %q", input)
+		}
+	}
+}
+
+func TestHashShorthandOutsidePatterns(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{"let name = 1; {name}", "hash shorthand {name} is only allowed in let and parameter patterns"},
+		{"{name, age: 3}", "hash shorthand {name} is only allowed in let and parameter patterns"},
+		{"let h = {a};", "hash shorthand {a} is only allowed in let and parameter patterns"},
+		{"fn(x = {y}) { x }", "hash shorthand {y} is only allowed in let and parameter patterns"},
+		{"match (h) { {a} => a }", "hash shorthand {a} is only allowed in let and parameter patterns"},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+
+		errors := p.GetErrors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q, got=%v, want=%q first", tt.input, errors, tt.expected)
+		}
+	}
+}
+
+func TestOptionalIndexInTernary(t *testing.T) {
+	// ?[ is always read as an optional index, a ternary needs a space
+	p := NewParser(lexer.NewLexer("c ?[1] : [2]"))
+	p.ParseProgram()
+
+	errors := p.GetErrors()
+	expected := "no prefix parse function for : found"
+	if len(errors) == 0 || errors[0] != expected {
+		t.Errorf("wrong errors, got=%v, want=%q first", errors, expected)
+	}
+}
+
+func TestDefaultAndRestParameters(t *testing.T) {
+	input := `let f = fn(x, y = 10, [a, b] = [1, 2], ...others) { x }; f(...xs, 1)`
+
+	l := lexer.NewLexer(input)
+	p := NewParser(l)
+	program := p.ParseProgram()
+	CheckParseErrors(t, p)
+
+	expected := "let f = fn(x, y = 10, [a, b] = [1, 2], ...others) x;f(...xs, 1)"
+	if program.String() != expected {
+		t.Errorf("expected=%q, got=%q", expected, program.String())
+	}
+
+	let := program.Statements[0].(*ast.LetStatement)
+	function, okay := let.Value.(*ast.FunctionLiteral)
+	if !okay {
+		t.Fatalf("let.Value is not ast.FunctionLiteral, got=%T", let.Value)
+	}
+
+	if function.Name != "f" {
+		t.Errorf("function.Name is not %q, got=%q", "f", function.Name)
+	}
+
+	parameter, okay := function.Parameters[1].(*ast.DefaultParameter)
+	if !okay {
+		t.Fatalf("function.Parameters[1] is not ast.DefaultParameter, got=%T", function.Parameters[1])
+	}
+
+	CheckIdentifier(t, parameter.Pattern, "y")
+	CheckIntegerLiteral(t, parameter.Default, 10)
+
+	rest, okay := function.Parameters[3].(*ast.SpreadExpression)
+	if !okay {
+		t.Fatalf("function.Parameters[3] is not ast.SpreadExpression, got=%T", function.Parameters[3])
+	}
+
+	CheckIdentifier(t, rest.Value, "others")
+
+	invalid := []string{
+		"fn(...rest, x) { x }",
+		"fn(x = 1, y) { x }",
+		"fn(...[a]) { a }",
+		"macro(x = 1) { x }",
+	}
+
+	for _, input := range invalid {
+		p := NewParser(lexer.NewLexer(input))
+		p.ParseProgram()
+
+		if len(p.GetErrors()) == 0 {
+			t.Errorf("expected parse error for %q", input)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	input := `let f = fn(x: int, y = 2, ...rest) -> int { if (x > -y) { return x * (y + 1) } else { puts("no", rest[0]) }; };
+const m = macro(a) { quote(unquote(a) + 1) };
+let [a, {"k": b}] = [1, {"k": h?[2]}];
+match (a) { 1 if b => "one", [x, ...xs] => x, _ => fn() {} }(a ? b : -c);`
+
+	expected := `let f = fn(x: int, y = 2, ...rest) -> int {
+    if (x > (-y)) {
+        return x * (y + 1);
+    } else {
+        puts("no", rest[0]);
+    };
+};
+const m = macro(a) {
+    quote(unquote(a) + 1);
+};
+let [a, {"k": b}] = [1, {"k": h?[2]}];
+match (a) {
+    1 if b => "one",
+    [x, ...xs] => x,
+    _ => fn() {}
+}(a ? b : (-c));`
+
+	p := NewParser(lexer.NewLexer(input))
+	program := p.ParseProgram()
+	CheckParseErrors(t, p)
+
+	formatted := ast.Format(program)
+	if formatted != expected {
+		t.Fatalf("wrong format, got=\n%s\nwant=\n%s", formatted, expected)
+	}
+
+	p = NewParser(lexer.NewLexer(formatted))
+	reparsed := p.ParseProgram()
+	CheckParseErrors(t, p)
+
+	if reparsed.String() != program.String() {
+		t.Errorf("formatted program parses differently, got=%q, want=%q", reparsed.String(), program.String())
+	}
+}
+
+func TestInfixDeclaration(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{"infix |> 1 = fn(a, f) { f(a) }; a + b |> c", "infix |> 1 left = fn(a, f) f(a);((a + b) |> c)"},
+		{"infix >>> 9 = f; a >>> b * c", "infix >>> 9 left = f;(a >>> (b * c))"},
+		{"infix <> 5 = f; a <> b * c <> d", "infix <> 5 left = f;((a <> (b * c)) <> d)"},
+		{"infix <> 5 left = f; a * b <> c", "infix <> 5 left = f;((a * b) <> c)"},
+		{"infix ** 10 right = f; a ** b ** -c", "infix ** 10 right = f;(a ** (b ** (-c)))"},
+		{"infix .. 3 = f; infix ..= 4 = g; a .. b ..= c", "infix .. 3 left = f;infix ..= 4 left = g;(a .. (b ..= c))"},
+		{"let f = fn() { infix ^^ 2 = g; a ^^ b }", "let f = fn() infix ^^ 2 left = g;(a ^^ b);"},
+		{"infix <> 2 = f; a |> b <> c ?? d", "infix <> 2 left = f;(a |> ((b <> c) ?? d))"},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		program := p.ParseProgram()
+		CheckParseErrors(t, p)
+
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+
+		p = NewParser(lexer.NewLexer(ast.Format(program)))
+		reparsed := p.ParseProgram()
+		CheckParseErrors(t, p)
+
+		if reparsed.String() != program.String() {
+			t.Errorf("formatted program parses differently, got=%q, want=%q", reparsed.String(), program.String())
+		}
+	}
+
+	declaration, okay := NewParser(lexer.NewLexer("infix |> 1 = fn(a, f) { f(a) }")).ParseProgram().Statements[0].(*ast.InfixDeclaration)
+	if !okay {
+		t.Fatalf("statement not *ast.InfixDeclaration")
+	}
+	if declaration.Name.Value != "infix |>" {
+		t.Errorf("wrong name, got=%q", declaration.Name.Value)
+	}
+	if fl, okay := declaration.Function.(*ast.FunctionLiteral); !okay || fl.Name != "infix |>" {
+		t.Errorf("function literal not named after the operator, got=%s", declaration.Function.String())
+	}
+}
+
+func TestInfixDeclarationErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		expected string
+	}{
+		{"infix + 1 = f", "cannot redefine built-in operator +"},
+		{"infix >> 1 = f", "cannot redefine built-in operator >>"},
+		{"infix ... 1 = f", "cannot redefine built-in operator ..."},
+		{"infix |> 0 = f", "operator precedence must be between 1 and 11, got 0"},
+		{"infix |> 12 = f", "operator precedence must be between 1 and 11, got 12"},
+		{"infix |> 1 up = f", "expected left or right after operator precedence, got up instead"},
+		{"infix |> = f", "expected next token to be INT, got = insted"},
+		{"infix foo 1 = f", "expected next token to be OPERATOR, got IDENT insted"},
+	}
+
+	for _, tt := range tests {
+		p := NewParser(lexer.NewLexer(tt.input))
+		p.ParseProgram()
+
+		errors := p.GetErrors()
+		if len(errors) == 0 || errors[0] != tt.expected {
+			t.Errorf("wrong errors for %q, got=%v, want=%q first", tt.input, errors, tt.expected)
+		}
+	}
+}
+
+func TestOperatorsAcrossParsers(t *testing.T) {
+	p := NewParser(lexer.NewLexer("infix |> 1 = f;"))
+	p.ParseProgram()
+	CheckParseErrors(t, p)
+
+	p = NewParserWithOperators(lexer.NewLexer("a |> b + c"), p.Operators)
+	program := p.ParseProgram()
+	CheckParseErrors(t, p)
+
+	if program.String() != "(a |> (b + c))" {
+		t.Errorf("wrong program, got=%q", program.String())
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"monkey/ast"
+	"monkey/checker"
 	"monkey/evaluator"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/resolver"
+	"strings"
 )
 
 const PROMPT = ">> "
@@ -16,6 +20,8 @@ func StartConsole(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
 	MacroEnv := object.NewEnvironment()
+	types := checker.NewChecker()
+	operators := map[string]parser.Operator{}
 
 	for {
 		fmt.Fprintf(out, PROMPT)
@@ -26,8 +32,14 @@ func StartConsole(in io.Reader, out io.Writer) {
 		}
 
 		line := scanner.Text()
+
+		if strings.HasPrefix(line, ":expand") {
+			Expand(out, strings.TrimPrefix(line, ":expand"), MacroEnv, operators)
+			continue
+		}
+
 		l := lexer.NewLexer(line)
-		p := parser.NewParser(l)
+		p := parser.NewParserWithOperators(l, operators)
 
 		program := p.ParseProgram()
 
@@ -35,15 +47,109 @@ func StartConsole(in io.Reader, out io.Writer) {
 			PrintParserErrors(out, p.GetErrors())
 			continue
 		}
+		operators = p.Operators
 
 		evaluator.DefineMacro(program, MacroEnv)
-        expanded := evaluator.ExpandMacro(program, MacroEnv)
+        expanded, err := evaluator.ExpandMacro(program, MacroEnv)
+		if err != nil {
+			io.WriteString(out, err.Inspect() + "\n")
+			continue
+		}
+
+		r := resolver.NewResolver(env.Names(), evaluator.BuiltinNames())
+		diagnostics := r.Resolve(expanded.(*ast.Program))
+		for _, d := range diagnostics {
+			io.WriteString(out, d.String() + "\n")
+		}
+		if resolver.HasErrors(diagnostics) {
+			continue
+		}
+
+		// the line's bindings are kept only if it runs without error
+		checked := types.Copy()
+		errors := checked.Check(expanded.(*ast.Program))
+		for _, err := range errors {
+			io.WriteString(out, "type error: " + err.String() + "\n")
+		}
+		if len(errors) != 0 {
+			continue
+		}
+
         evaluated := evaluator.Eval(expanded, env)
 
 		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect() + "\n")
 		}
+		if !evaluator.IsError(evaluated) {
+			types = checked
+		}
+	}
+}
+
+// Expand implements `:expand [-steps] <code>`, which shows the code after
+// macro expansion without running it or keeping its macro definitions and
+// operator declarations
+func Expand(out io.Writer, args string, MacroEnv *object.Environment, operators map[string]parser.Operator) {
+	args = strings.TrimSpace(args)
+	steps := strings.HasPrefix(args, "-steps")
+	if steps {
+		args = strings.TrimSpace(strings.TrimPrefix(args, "-steps"))
+	}
+
+	if args == "" {
+		io.WriteString(out, "usage: :expand [-steps] <code>\n")
+		return
+	}
+
+	p := parser.NewParserWithOperators(lexer.NewLexer(args), operators)
+	program := p.ParseProgram()
+
+	if len(p.GetErrors()) != 0 {
+		PrintParserErrors(out, p.GetErrors())
+		return
+	}
+
+	PrintExpansion(out, program, object.NewEnclosedEnvironment(MacroEnv), steps)
+}
+
+// PrintExpansion defines the macros of program in env, expands it and
+// prints the result formatted. With steps it first prints each expanded
+// call with the macro chain that produced it and its output. It reports
+// whether expansion succeeded.
+func PrintExpansion(out io.Writer, program *ast.Program, env *object.Environment, steps bool) bool {
+	count := 0
+	var trace func(evaluator.ExpansionStep)
+
+	if steps {
+		trace = func(step evaluator.ExpansionStep) {
+			count += 1
+			fmt.Fprintf(out, "[%d] %s\n", count, strings.Join(step.Chain, " -> "))
+			io.WriteString(out, Indent(ast.Format(step.Call), "    ", "    ") + "\n")
+			io.WriteString(out, Indent(ast.Format(step.Output), "    => ", "       ") + "\n")
+		}
+	}
+
+	evaluator.DefineMacro(program, env)
+	expanded, err := evaluator.ExpandMacroSteps(program, env, trace)
+	if err != nil {
+		io.WriteString(out, err.Inspect() + "\n")
+		return false
 	}
+
+	if steps {
+		if count == 0 {
+			io.WriteString(out, "no macro calls\n")
+		}
+		io.WriteString(out, "\n")
+	}
+
+	io.WriteString(out, ast.Format(expanded) + "\n")
+	return true
+}
+
+// Indent prefixes the first line of text with first and the others with rest
+func Indent(text string, first string, rest string) string {
+	return first + strings.Replace(text, "\n", "\n" + rest, -1)
 }
 
 const MonkeyFace = `            __,__
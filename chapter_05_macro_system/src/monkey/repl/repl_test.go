@@ -0,0 +1,64 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// CheckConsole runs the lines in a console and returns what each printed
+func CheckConsole(lines ...string) []string {
+	var out bytes.Buffer
+	StartConsole(strings.NewReader(strings.Join(lines, "\n") + "\n"), &out)
+
+	outputs := strings.Split(out.String(), PROMPT)
+	return outputs[1:len(outputs) - 1]
+}
+
+func TestRejectedLinesKeepTypes(t *testing.T) {
+	tests := []struct {
+		lines []string
+		expected []string
+	}{
+		{
+			[]string{`let x = 5;`, `let x = "a"; x - 1`, `x`, `x + 1`},
+			[]string{"", "type error: type mismatch: string - int\n", "5\n", "6\n"},
+		},
+		{
+			[]string{`let s = "a";`, `s - 1`},
+			[]string{"", "type error: type mismatch: string - int\n"},
+		},
+		{
+			[]string{`let n = 1;`, `let n = "a"; len(1)`, `n + 1`},
+			[]string{"", "ERROR: argument to len not supported, got INTEGER\n", "ERROR: type mismatch: STRING + INTEGER\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		CheckOutputs(t, tt.lines, tt.expected)
+	}
+}
+
+// a failed line leaves the slots of its later bindings empty, and the next
+// line may fill them with other names that functions of the line must skip
+func TestSlotsAfterFailedLine(t *testing.T) {
+	lines := []string{`let f = fn() { g }; [1][5](); let g = 1;`, `let h = 5;`, `let i = 9;`, `f()`, `let g = 7;`, `f()`}
+	expected := []string{"ERROR: not a function: NULL\n", "", "", "ERROR: identifier not found: g\n", "", "7\n"}
+
+	CheckOutputs(t, lines, expected)
+}
+
+func CheckOutputs(t *testing.T, lines []string, expected []string) {
+	outputs := CheckConsole(lines...)
+
+	if len(outputs) != len(expected) {
+		t.Errorf("wrong number of outputs for %q, got=%q", lines, outputs)
+		return
+	}
+
+	for i, output := range outputs {
+		if output != expected[i] {
+			t.Errorf("wrong output for %q, got=%q, want=%q", lines[i], output, expected[i])
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package resolver
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+	"strings"
+)
+
+type Severity int
+
+const (
+	WARNING Severity = iota
+	ERROR
+)
+
+func (s Severity) String() string {
+	if s == ERROR {
+		return "error"
+	}
+	return "warning"
+}
+
+// kinds of diagnostics, also used as rule IDs by the linter
+const (
+	UNDEFINED = "undefined-variable"
+	UNUSED = "unused-variable"
+)
+
+type Diagnostic struct {
+	Severity Severity
+	Kind string
+	Token token.Token
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return d.Severity.String() + ": " + d.Message
+}
+
+type Binding struct {
+	Name string
+	Slot int
+	Token token.Token
+	Parameter bool
+	Used bool
+}
+
+// Scope mirrors an environment created at run time: the program, a function
+// call or a match arm. Block statements share the scope they appear in.
+type Scope struct {
+	outer *Scope
+	bindings map[string]*Binding
+	order []*Binding
+	size int
+	global bool
+	deferred []func()
+}
+
+func NewScope(outer *Scope) *Scope {
+	return &Scope{outer: outer, bindings: make(map[string]*Binding)}
+}
+
+// Resolver binds every identifier of a program to the scope depth and slot
+// of its definition, and reports undefined and unused names on the way
+type Resolver struct {
+	scope *Scope
+	builtins map[string]bool
+	diagnostics []Diagnostic
+
+	// ReportUnusedGlobals also reports unused top level bindings,
+	// which are expected in the REPL
+	ReportUnusedGlobals bool
+}
+
+// NewResolver takes the names already bound in the global environment,
+// indexed by slot as returned by Environment.Names, and the builtin names
+func NewResolver(globals []string, builtins []string) *Resolver {
+	r := &Resolver{scope: NewScope(nil), builtins: make(map[string]bool)}
+	r.scope.global = true
+
+	for slot, name := range globals {
+		if name == "" {
+			continue
+		}
+		binding := &Binding{Name: name, Slot: slot, Used: true}
+		r.scope.bindings[name] = binding
+	}
+	r.scope.size = len(globals)
+
+	for _, name := range builtins {
+		r.builtins[name] = true
+	}
+
+	return r
+}
+
+func (r *Resolver) Resolve(program *ast.Program) []Diagnostic {
+	r.diagnostics = []Diagnostic{}
+
+	for _, stmt := range program.Statements {
+		r.ResolveNode(stmt)
+	}
+	r.CloseScope(r.scope)
+
+	return r.diagnostics
+}
+
+func (r *Resolver) ResolveNode(node ast.Node) {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		r.ResolveNode(node.Expression)
+
+	case *ast.LetStatement:
+		r.ResolveNode(node.Value)
+		if node.Pattern != nil {
+			r.DeclarePattern(node.Pattern, false)
+		} else {
+			r.Declare(node.Name, false)
+		}
+
+	case *ast.ReturnStatement:
+		r.ResolveNode(node.Value)
+
+	case *ast.InfixDeclaration:
+		r.ResolveNode(node.Function)
+		r.Declare(node.Name, false)
+
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			r.ResolveNode(stmt)
+		}
+
+	case *ast.Identifier:
+		r.Lookup(node)
+
+	case *ast.PrefixExpression:
+		r.ResolveNode(node.Operand)
+
+	case *ast.InfixExpression:
+		r.ResolveNode(node.OperandLeft)
+		r.ResolveNode(node.OperandRight)
+		if node.Function != nil {
+			r.Lookup(node.Function)
+		}
+
+	case *ast.IfExpression:
+		r.ResolveNode(node.Condition)
+		r.ResolveNode(node.Consequence)
+		if node.Alternative != nil {
+			r.ResolveNode(node.Alternative)
+		}
+
+	case *ast.ConditionalExpression:
+		r.ResolveNode(node.Condition)
+		r.ResolveNode(node.Consequence)
+		r.ResolveNode(node.Alternative)
+
+	case *ast.MatchExpression:
+		r.ResolveNode(node.Subject)
+		for _, arm := range node.Arms {
+			r.ResolveMatchArm(arm)
+		}
+
+	case *ast.IndexExpression:
+		r.ResolveNode(node.Array)
+		r.ResolveNode(node.Index)
+
+	case *ast.ArrayLiteral:
+		for _, element := range node.Elements {
+			r.ResolveNode(element)
+		}
+
+	case *ast.HashLiteral:
+		for _, key := range node.Keys {
+			r.ResolveNode(key)
+			r.ResolveNode(node.Pairs[key])
+		}
+
+	case *ast.SpreadExpression:
+		r.ResolveNode(node.Value)
+
+	case *ast.CallExpression:
+		if node.Function.TokenLiteral() == "quote" {
+			for _, arg := range node.Arguments {
+				r.ResolveUnquoted(arg)
+			}
+			return
+		}
+		r.ResolveNode(node.Function)
+		for _, arg := range node.Arguments {
+			r.ResolveNode(arg)
+		}
+
+	case *ast.FunctionLiteral:
+		// function bodies are resolved once the enclosing scope is complete,
+		// so that they can refer to themselves and to later definitions
+		outer := r.scope
+		outer.deferred = append(outer.deferred, func() {
+			r.ResolveFunctionLiteral(node, outer)
+		})
+	}
+}
+
+func (r *Resolver) ResolveFunctionLiteral(fl *ast.FunctionLiteral, outer *Scope) {
+	saved := r.scope
+	r.scope = NewScope(outer)
+
+	for _, param := range fl.Parameters {
+		switch param := param.(type) {
+		case *ast.DefaultParameter:
+			r.ResolveNode(param.Default)
+			r.DeclarePattern(param.Pattern, true)
+		case *ast.SpreadExpression:
+			r.DeclarePattern(param.Value, true)
+		default:
+			r.DeclarePattern(param, true)
+		}
+	}
+
+	r.ResolveNode(fl.Body)
+	r.CloseScope(r.scope)
+
+	r.scope = saved
+}
+
+func (r *Resolver) ResolveMatchArm(arm *ast.MatchArm) {
+	saved := r.scope
+	r.scope = NewScope(saved)
+
+	r.DeclareMatchPattern(arm.Pattern)
+	if arm.Guard != nil {
+		r.ResolveNode(arm.Guard)
+	}
+	r.ResolveNode(arm.Body)
+	r.CloseScope(r.scope)
+
+	r.scope = saved
+}
+
+// ResolveUnquoted resolves the arguments of the unquote and unquote_splice
+// calls in a quoted node, the rest of it is only data
+func (r *Resolver) ResolveUnquoted(quoted ast.Node) {
+	ast.Inspect(quoted, func(node ast.Node) bool {
+		if call, okay := node.(*ast.CallExpression); okay && (call.Function.TokenLiteral() == "unquote" || call.Function.TokenLiteral() == "unquote_splice") {
+			for _, arg := range call.Arguments {
+				r.ResolveNode(arg)
+			}
+			return false
+		}
+		return true
+	})
+}
+
+// DeclarePattern declares the identifiers of a binding pattern,
+// hash keys are expressions evaluated in the current scope
+func (r *Resolver) DeclarePattern(pattern ast.Expression, parameter bool) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		r.Declare(pattern, parameter)
+
+	case *ast.ArrayLiteral:
+		for _, element := range pattern.Elements {
+			if spread, okay := element.(*ast.SpreadExpression); okay {
+				element = spread.Value
+			}
+			r.DeclarePattern(element, parameter)
+		}
+
+	case *ast.HashLiteral:
+		for _, key := range pattern.Keys {
+			r.ResolveNode(key)
+			r.DeclarePattern(pattern.Pairs[key], parameter)
+		}
+	}
+}
+
+// DeclareMatchPattern is like DeclarePattern, except that literals are
+// allowed and compared against the subject
+func (r *Resolver) DeclareMatchPattern(pattern ast.Expression) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		r.Declare(pattern, false)
+
+	case *ast.ArrayLiteral:
+		for _, element := range pattern.Elements {
+			if spread, okay := element.(*ast.SpreadExpression); okay {
+				element = spread.Value
+			}
+			r.DeclareMatchPattern(element)
+		}
+
+	case *ast.HashLiteral:
+		for _, key := range pattern.Keys {
+			r.ResolveNode(key)
+			r.DeclareMatchPattern(pattern.Pairs[key])
+		}
+
+	default:
+		r.ResolveNode(pattern)
+	}
+}
+
+func (r *Resolver) Declare(identifier *ast.Identifier, parameter bool) {
+	if identifier.Value == "_" {
+		return
+	}
+
+	binding, okay := r.scope.bindings[identifier.Value]
+	if !okay {
+		binding = &Binding{Name: identifier.Value, Slot: r.scope.size, Token: identifier.Token, Parameter: parameter}
+		r.scope.bindings[identifier.Value] = binding
+		r.scope.order = append(r.scope.order, binding)
+		r.scope.size += 1
+	}
+
+	identifier.Resolved = true
+	identifier.Depth = 0
+	identifier.Slot = binding.Slot
+}
+
+func (r *Resolver) Lookup(identifier *ast.Identifier) {
+	depth := 0
+	for scope := r.scope; scope != nil; scope = scope.outer {
+		if binding, okay := scope.bindings[identifier.Value]; okay {
+			binding.Used = true
+			identifier.Resolved = true
+			identifier.Depth = depth
+			identifier.Slot = binding.Slot
+			return
+		}
+		depth += 1
+	}
+
+	// builtins are not stored in environments and stay unresolved
+	if r.builtins[identifier.Value] {
+		return
+	}
+
+	r.Report(ERROR, UNDEFINED, identifier.Token, "undefined variable: %s", identifier.Value)
+}
+
+// CloseScope resolves the functions deferred in scope, then reports its
+// unused bindings. Parameters and names starting with _ are never reported.
+func (r *Resolver) CloseScope(scope *Scope) {
+	for len(scope.deferred) > 0 {
+		deferred := scope.deferred[0]
+		scope.deferred = scope.deferred[1:]
+		deferred()
+	}
+
+	if scope.global && !r.ReportUnusedGlobals {
+		return
+	}
+
+	for _, binding := range scope.order {
+		if binding.Used || binding.Parameter || strings.HasPrefix(binding.Name, "_") {
+			continue
+		}
+		r.Report(WARNING, UNUSED, binding.Token, "unused variable: %s", binding.Name)
+	}
+}
+
+func (r *Resolver) Report(severity Severity, kind string, tok token.Token, format string, a ...interface{}) {
+	r.diagnostics = append(r.diagnostics, Diagnostic{Severity: severity, Kind: kind, Token: tok, Message: fmt.Sprintf(format, a...)})
+}
+
+// HasErrors tells whether any of diagnostics is an error
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == ERROR {
+			return true
+		}
+	}
+	return false
+}
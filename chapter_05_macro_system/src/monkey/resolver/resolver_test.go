@@ -0,0 +1,118 @@
+package resolver
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func CheckResolve(t *testing.T, input string, globals []string) (*ast.Program, []Diagnostic) {
+	l := lexer.NewLexer(input)
+	p := parser.NewParser(l)
+	program := p.ParseProgram()
+
+	if len(p.GetErrors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.GetErrors())
+	}
+
+	r := NewResolver(globals, []string{"len", "puts"})
+	return program, r.Resolve(program)
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input string
+		expected []string
+	}{
+		{ `let x = 1; x`, []string{} },
+		{ `let x = 1;`, []string{} },
+		{ `y`, []string{"error: undefined variable: y"} },
+		{ `y; let y = 1;`, []string{"error: undefined variable: y"} },
+		{ `len([1]); puts(1)`, []string{} },
+		{ `let f = fn(x) { x + z };`, []string{"error: undefined variable: z"} },
+		{ `let f = fn(x) { let y = 1; x };`, []string{"warning: unused variable: y"} },
+		{ `let f = fn(x) { let _y = 1; x };`, []string{} },
+		{ `let f = fn(x, unused) { x };`, []string{} },
+		{ `let f = fn(n) { f(n - 1) };`, []string{} },
+		{ `let even = fn(n) { odd(n) }; let odd = fn(n) { even(n) };`, []string{} },
+		{ `let f = fn(x, y = x) { y };`, []string{} },
+		{ `let f = fn(y = x, x = 1) { y };`, []string{"error: undefined variable: x"} },
+		{ `let f = fn(...rest) { rest };`, []string{} },
+		{ `let [a, {"k": b}] = [1, {"k": 2}]; a + b`, []string{} },
+		{ `match (1) { [a, b] => a, n if n > 0 => n, _ => 0 }`, []string{"warning: unused variable: b"} },
+		{ `match (1) { n => n }; n`, []string{"error: undefined variable: n"} },
+		{ `let x = 1; quote(x + unquote(x))`, []string{} },
+		{ `quote(y + unquote(z))`, []string{"error: undefined variable: z"} },
+		{ `if (true) { let x = 1 }; x`, []string{} },
+		{ `infix |> 1 = fn(a, f) { f(a) }; 1 |> puts`, []string{} },
+		{ `infix |> 1 = fn(a, f) { g(a) };`, []string{"error: undefined variable: g"} },
+		{ `let f = fn() { infix |> 1 = fn(a, b) { a }; 1 };`, []string{"warning: unused variable: infix |>"} },
+		{ `let f = fn() { infix |> 1 = fn(a, b) { a } }; 1 |> 2`, []string{"error: undefined variable: infix |>", "warning: unused variable: infix |>"} },
+	}
+
+	for _, tt := range tests {
+		_, diagnostics := CheckResolve(t, tt.input, nil)
+
+		if len(diagnostics) != len(tt.expected) {
+			t.Errorf("wrong number of diagnostics for %q, got=%v, want=%v", tt.input, diagnostics, tt.expected)
+			continue
+		}
+
+		for i, d := range diagnostics {
+			if d.String() != tt.expected[i] {
+				t.Errorf("wrong diagnostic for %q, got=%q, want=%q", tt.input, d.String(), tt.expected[i])
+			}
+		}
+	}
+}
+
+func TestUnusedGlobals(t *testing.T) {
+	l := lexer.NewLexer(`let x = 1; let y = 2; y`)
+	p := parser.NewParser(l)
+	program := p.ParseProgram()
+
+	r := NewResolver(nil, nil)
+	r.ReportUnusedGlobals = true
+	diagnostics := r.Resolve(program)
+
+	if len(diagnostics) != 1 || diagnostics[0].String() != "warning: unused variable: x" {
+		t.Fatalf("wrong diagnostics, got=%v", diagnostics)
+	}
+}
+
+func TestSlots(t *testing.T) {
+	input := `let a = 1; let b = 2; let f = fn(x) { let c = x; fn() { b + c } };`
+	program, diagnostics := CheckResolve(t, input, []string{"g", "", "h"})
+
+	if len(diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics: %v", diagnostics)
+	}
+
+	CheckSlot(t, program.Statements[0].(*ast.LetStatement).Name, 0, 3)
+	CheckSlot(t, program.Statements[1].(*ast.LetStatement).Name, 0, 4)
+	CheckSlot(t, program.Statements[2].(*ast.LetStatement).Name, 0, 5)
+
+	f := program.Statements[2].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	CheckSlot(t, f.Parameters[0].(*ast.Identifier), 0, 0)
+
+	let := f.Body.Statements[0].(*ast.LetStatement)
+	CheckSlot(t, let.Name, 0, 1)
+	CheckSlot(t, let.Value.(*ast.Identifier), 0, 0)
+
+	inner := f.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	sum := inner.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	CheckSlot(t, sum.OperandLeft.(*ast.Identifier), 2, 4)
+	CheckSlot(t, sum.OperandRight.(*ast.Identifier), 1, 1)
+}
+
+func CheckSlot(t *testing.T, identifier *ast.Identifier, depth int, slot int) {
+	if !identifier.Resolved {
+		t.Errorf("%s not resolved", identifier.Value)
+		return
+	}
+
+	if identifier.Depth != depth || identifier.Slot != slot {
+		t.Errorf("wrong location for %s, got=(%d, %d), want=(%d, %d)", identifier.Value, identifier.Depth, identifier.Slot, depth, slot)
+	}
+}
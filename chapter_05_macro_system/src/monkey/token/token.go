@@ -2,9 +2,13 @@ package token
 
 type TokenType string
 
+// Token records the 1-based Line and Column where it starts,
+// tokens built outside the lexer leave them zero
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line int
+	Column int
 }
 
 const (
@@ -28,6 +32,24 @@ const (
 	EQ = "=="
 	NOT_EQ = "!="
 
+	AMPERSAND = "&"
+	PIPE = "|"
+	CARET = "^"
+	TILDE = "~"
+	SHIFT_LEFT = "<<"
+	SHIFT_RIGHT = ">>"
+
+	PIPELINE = "|>"
+	COMPOSE = ">>>"
+
+	NULL_COALESCE = "??"
+	OPTIONAL_LBRACKET = "?["
+	QUESTION = "?"
+	ARROW = "=>"
+	THIN_ARROW = "->"
+	ELLIPSIS = "..."
+	OPERATOR = "OPERATOR"	// declared by an infix statement
+
 	COMMA = ","
 	SEMICOLON = ";"
 	COLON = ":"
@@ -41,26 +63,34 @@ const (
 
 	FUNCTION = "FUNCTION"
 	LET = "LET"
+	CONST = "CONST"
 	TRUE = "TRUE"
 	FALSE = "FALSE"
 	IF = "IF"
 	ELSE = "ELSE"
 	RETURN = "RETURN"
+	NULL = "NULL"
+	MATCH = "MATCH"
 
 	STRING = "STRING"
 
 	MACRO = "MACRO"
+	INFIX = "INFIX"
 )
 
 var keywords = map[string] TokenType {
 	"fn": FUNCTION,
 	"let": LET,
+	"const": CONST,
 	"true": TRUE,
 	"false": FALSE,
 	"if": IF,
 	"else": ELSE,
 	"return": RETURN,
+	"null": NULL,
+	"match": MATCH,
 	"macro": MACRO,
+	"infix": INFIX,
 }
 
 func LookUpIdent(ident string) TokenType {